@@ -1,18 +1,56 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"path/filepath"
 	"scuffed-v2/internal/api"
 )
 
 func main() {
+	dataDir := flag.String("data", "data", "directory observation history and GFA images are kept in")
+	alertsPath := flag.String("alerts", "", "json file of alert rules and webhooks, alerts are off when unset")
+	flag.Parse()
+
+	err := api.OpenHistory(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = api.OpenGFAImages(filepath.Join(*dataDir, "gfa"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *alertsPath != "" {
+		err = api.LoadAlerts(*alertsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	api.StartPolling(context.Background())
+
 	r := mux.NewRouter()
 
 	r.HandleFunc("/metar", api.GetMetar)
 	r.HandleFunc("/gfa", api.GetGFA)
+	r.HandleFunc("/gfa/frames", api.GetGFAFrames)
+	r.HandleFunc("/gfa/{type}/{id:[0-9]+}.png", api.GetGFAImage)
 	r.HandleFunc("/winds", api.GetWinds)
+	r.HandleFunc("/winds/aloft", api.GetWindsAloft)
+	r.HandleFunc("/advisories", api.GetAdvisories)
+	r.HandleFunc("/notam", api.GetNotams)
+	r.HandleFunc("/pirep", api.GetPireps)
+	r.HandleFunc("/briefing", api.GetBriefing)
+	r.HandleFunc("/jobs", api.GetJobs)
+	r.HandleFunc("/sites", api.GetSites)
+	r.HandleFunc("/sources", api.GetSources)
+	r.HandleFunc("/history", api.GetHistory)
+	r.HandleFunc("/stream", api.GetStream)
 
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
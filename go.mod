@@ -3,12 +3,14 @@ module scuffed-v2
 go 1.23.0
 
 require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
 	github.com/gorilla/mux v1.8.1
+	go.etcd.io/bbolt v1.4.3
 	golang.org/x/net v0.42.0
+	golang.org/x/sync v0.10.0
 )
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.5.0 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
-	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
 )
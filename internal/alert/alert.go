@@ -0,0 +1,370 @@
+// Package alert evaluates rules against new observations and notifies webhooks when they start matching
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/util"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCooldown = 30 * time.Minute
+
+// Duration is a time.Duration written as a string in config e.g. "30m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type Format string
+
+const (
+	Slack   Format = "slack"   // {"text": "..."}
+	Generic Format = "generic" // the Notification as JSON
+)
+
+type Webhook struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Format Format `json:"format"`
+}
+
+// A Rule matches an observation when every condition that is set matches, e.g. a CeilingBelow of 1000 for CJY4
+type Rule struct {
+	Name  string   `json:"name"`
+	Sites []string `json:"sites"`
+
+	CeilingBelow    *int                 `json:"ceiling_below,omitempty"`    // feet AGL
+	VisibilityBelow *float64             `json:"visibility_below,omitempty"` // statute miles
+	Category        metar.FlightCategory `json:"category,omitempty"`         // this category or worse
+	WindAbove       *int                 `json:"wind_above,omitempty"`       // knots, including gusts
+	Speci           bool                 `json:"speci,omitempty"`
+
+	// Webhooks are the names of the webhooks to notify, every webhook when empty
+	Webhooks []string `json:"webhooks,omitempty"`
+	// Cooldown is the least time between notifications for a site, Config.Cooldown when unset
+	Cooldown Duration `json:"cooldown,omitempty"`
+}
+
+// Matches reports whether obs meets every condition in r, along with why
+func (r Rule) Matches(obs metar.Observation) (bool, []string) {
+	var reasons []string
+
+	if r.CeilingBelow != nil {
+		ceiling := obs.Ceiling()
+		if ceiling == nil || *ceiling >= *r.CeilingBelow {
+			return false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("ceiling %dft below %dft", *ceiling, *r.CeilingBelow))
+	}
+
+	if r.VisibilityBelow != nil {
+		if obs.Visibility == nil || obs.Visibility.Miles >= *r.VisibilityBelow {
+			return false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("visibility %gSM below %gSM", obs.Visibility.Miles, *r.VisibilityBelow))
+	}
+
+	if r.Category != "" {
+		category := obs.FlightCategory()
+		if category == metar.Unknown || r.Category.Worse(category) {
+			return false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s conditions", category))
+	}
+
+	if r.WindAbove != nil {
+		if obs.Wind == nil || max(obs.Wind.Speed, obs.Wind.Gust) <= *r.WindAbove {
+			return false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("wind %dkt above %dkt", max(obs.Wind.Speed, obs.Wind.Gust), *r.WindAbove))
+	}
+
+	if r.Speci {
+		if obs.Type != metar.Speci {
+			return false, nil
+		}
+		reasons = append(reasons, "SPECI issued")
+	}
+
+	return len(reasons) > 0, reasons
+}
+
+type Config struct {
+	Cooldown Duration  `json:"cooldown,omitempty"`
+	Webhooks []Webhook `json:"webhooks"`
+	Rules    []Rule    `json:"rules"`
+}
+
+// LoadConfig reads the rules and webhooks in the json file at path
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	err := util.ReadFileToStruct(path, &config)
+	if err != nil {
+		return Config{}, err
+	}
+	return config, config.validate()
+}
+
+func (c Config) validate() error {
+	for _, webhook := range c.Webhooks {
+		if webhook.Format != Slack && webhook.Format != Generic {
+			return fmt.Errorf("webhook %q: unknown format %q", webhook.Name, webhook.Format)
+		}
+	}
+
+	for _, rule := range c.Rules {
+		if rule.Name == "" || len(rule.Sites) == 0 {
+			return fmt.Errorf("rule %q: a name and sites are required", rule.Name)
+		}
+		if rule.Category != "" && !slices.Contains(metar.FlightCategories, rule.Category) {
+			return fmt.Errorf("rule %q: unknown flight category %q", rule.Name, rule.Category)
+		}
+		if rule.CeilingBelow == nil && rule.VisibilityBelow == nil && rule.Category == "" && rule.WindAbove == nil && !rule.Speci {
+			return fmt.Errorf("rule %q: has no conditions", rule.Name)
+		}
+		if len(rule.Webhooks) == 0 && len(c.Webhooks) == 0 {
+			return fmt.Errorf("rule %q: there are no webhooks to notify", rule.Name)
+		}
+		for _, name := range rule.Webhooks {
+			if !slices.ContainsFunc(c.Webhooks, func(webhook Webhook) bool { return webhook.Name == name }) {
+				return fmt.Errorf("rule %q: unknown webhook %q", rule.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// A Notification is sent to a rule's webhooks when it starts matching a site's observations
+type Notification struct {
+	Rule        string            `json:"rule"`
+	Site        string            `json:"site"`
+	Message     string            `json:"message"`
+	Observation metar.Observation `json:"observation"`
+}
+
+type stateKey struct {
+	rule string
+	site string
+}
+
+type ruleState struct {
+	notified    bool      // whether the rule has been notified since it started matching
+	observation time.Time // the newest observation handled, an observation isn't handled until its notification is sent
+	sent        time.Time
+	// sending is the observation a notification is being sent for, so the same observation from another source isn't
+	// sent twice at once
+	sending time.Time
+	// failed is the newest observation whose notification couldn't be sent, it is retried by Retry
+	failed *metar.Observation
+}
+
+// Engine notifies webhooks when a rule starts matching a site. It isn't notified again until the rule stops matching
+// and starts again, and never more often than the cooldown, so repeated polls of the same conditions don't re-send
+type Engine struct {
+	config Config
+	client *util.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	state map[stateKey]*ruleState
+}
+
+func NewEngine(config Config) *Engine {
+	return &Engine{
+		config: config,
+		client: util.DefaultClient,
+		now:    time.Now,
+		state:  make(map[stateKey]*ruleState),
+	}
+}
+
+// Evaluate checks obs for site against every rule, sending any notifications and returning what was sent
+func (e *Engine) Evaluate(ctx context.Context, site string, obs metar.Observation) []Notification {
+	var res []Notification
+	for _, rule := range e.config.Rules {
+		if !slices.Contains(rule.Sites, site) {
+			continue
+		}
+		if notification, ok := e.notify(ctx, rule, site, obs); ok {
+			res = append(res, notification)
+		}
+	}
+	return res
+}
+
+// Retry evaluates every observation whose notification couldn't be sent again, returning what was sent
+func (e *Engine) Retry(ctx context.Context) []Notification {
+	type retry struct {
+		key stateKey
+		obs metar.Observation
+	}
+
+	e.mu.Lock()
+	var retries []retry
+	for key, state := range e.state {
+		if state.failed != nil {
+			retries = append(retries, retry{key, *state.failed})
+			state.failed = nil
+		}
+	}
+	e.mu.Unlock()
+
+	var res []Notification
+	for _, r := range retries {
+		i := slices.IndexFunc(e.config.Rules, func(rule Rule) bool { return rule.Name == r.key.rule })
+		if i < 0 {
+			continue
+		}
+		if notification, ok := e.notify(ctx, e.config.Rules[i], r.key.site, r.obs); ok {
+			res = append(res, notification)
+		}
+	}
+	return res
+}
+
+// notify sends the notification for rule if obs starts it matching, only recording obs as handled once it is sent
+func (e *Engine) notify(ctx context.Context, rule Rule, site string, obs metar.Observation) (Notification, bool) {
+	notification, ok := e.evaluate(rule, site, obs)
+	if !ok {
+		return Notification{}, false
+	}
+
+	sent := false
+	for _, webhook := range e.webhooks(rule) {
+		err := e.send(ctx, webhook, notification)
+		if err != nil {
+			slog.Error("Unable to send alert",
+				slog.String("rule", rule.Name),
+				slog.String("webhook", webhook.Name),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		sent = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state := e.state[stateKey{rule.Name, site}]
+	if state.sending.Equal(obs.Time) {
+		state.sending = time.Time{}
+	}
+
+	switch {
+	case !obs.Time.After(state.observation):
+		// a newer observation was handled while this one was being sent
+	case sent:
+		state.observation = obs.Time
+		state.notified = true
+		state.sent = e.now()
+		state.failed = nil
+	case state.failed == nil || obs.Time.After(state.failed.Time):
+		state.failed = &obs
+	}
+	return notification, sent
+}
+
+// evaluate checks obs against rule for site, returning a notification if one should be sent. Observations that don't
+// need one are recorded as handled straight away
+func (e *Engine) evaluate(rule Rule, site string, obs metar.Observation) (Notification, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := stateKey{rule.Name, site}
+	state, ok := e.state[key]
+	if !ok {
+		state = &ruleState{}
+		e.state[key] = state
+	}
+
+	// older or repeated observations, e.g. the same report from another source
+	if !obs.Time.After(state.observation) || !obs.Time.After(state.sending) {
+		return Notification{}, false
+	}
+
+	matches, reasons := rule.Matches(obs)
+	if !matches {
+		state.observation = obs.Time
+		state.notified = false
+		state.failed = nil
+		return Notification{}, false
+	}
+
+	cooldown := time.Duration(rule.Cooldown)
+	if cooldown == 0 {
+		cooldown = time.Duration(e.config.Cooldown)
+	}
+	if cooldown == 0 {
+		cooldown = defaultCooldown
+	}
+
+	if state.notified || (!state.sent.IsZero() && e.now().Sub(state.sent) < cooldown) {
+		state.observation = obs.Time
+		state.failed = nil
+		return Notification{}, false
+	}
+
+	state.sending = obs.Time
+	return Notification{
+		Rule:        rule.Name,
+		Site:        site,
+		Message:     fmt.Sprintf("%s %s: %s", site, strings.Join(reasons, ", "), obs.Raw),
+		Observation: obs,
+	}, true
+}
+
+func (e *Engine) webhooks(rule Rule) []Webhook {
+	if len(rule.Webhooks) == 0 {
+		return e.config.Webhooks
+	}
+	return slices.DeleteFunc(slices.Clone(e.config.Webhooks), func(webhook Webhook) bool {
+		return !slices.Contains(rule.Webhooks, webhook.Name)
+	})
+}
+
+func (e *Engine) send(ctx context.Context, webhook Webhook, notification Notification) error {
+	var payload any = notification
+	if webhook.Format == Slack {
+		payload = struct {
+			Text string `json:"text"`
+		}{notification.Message}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = e.client.Do(ctx, req)
+	return err
+}
@@ -0,0 +1,176 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/util"
+	"sync"
+	"testing"
+	"time"
+)
+
+var ref = time.Date(2025, 6, 25, 2, 0, 0, 0, time.UTC)
+
+func parse(t *testing.T, raw string) metar.Observation {
+	t.Helper()
+	obs, err := metar.Parse(raw, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obs
+}
+
+func TestRuleMatches(t *testing.T) {
+	ceiling, visibility, wind := 1000, 3.0, 25
+	cases := []struct {
+		rule     Rule
+		raw      string
+		expected bool
+	}{
+		{Rule{CeilingBelow: &ceiling}, "METAR CJY4 250000Z 31012KT 15SM OVC008 21/05 A2992", true},
+		{Rule{CeilingBelow: &ceiling}, "METAR CJY4 250000Z 31012KT 15SM OVC010 21/05 A2992", false},
+		{Rule{CeilingBelow: &ceiling}, "METAR CJY4 250000Z 31012KT 15SM FEW005 21/05 A2992", false},
+		{Rule{VisibilityBelow: &visibility}, "METAR CJY4 250000Z 31012KT 1/2SM FG 21/05 A2992", true},
+		{Rule{Category: metar.IFR}, "METAR CJY4 250000Z 31012KT 1/2SM FG VV002 21/05 A2992", true},
+		{Rule{Category: metar.IFR}, "METAR CJY4 250000Z 31012KT 4SM -RA SCT010 21/05 A2992", false},
+		{Rule{WindAbove: &wind}, "METAR CJY4 250000Z 31015G30KT 15SM CLR 21/05 A2992", true},
+		{Rule{Speci: true}, "SPECI CYSF 250012Z 31012KT 15SM CLR 21/05 A2992", true},
+		{Rule{Speci: true}, "METAR CYSF 250000Z 31012KT 15SM CLR 21/05 A2992", false},
+		// every condition has to match
+		{Rule{Speci: true, CeilingBelow: &ceiling}, "SPECI CYSF 250012Z 31012KT 15SM CLR 21/05 A2992", false},
+		{Rule{}, "METAR CYSF 250000Z 31012KT 15SM CLR 21/05 A2992", false},
+	}
+
+	for _, tc := range cases {
+		if actual, _ := tc.rule.Matches(parse(t, tc.raw)); actual != tc.expected {
+			t.Fatalf("%+v %q: expected %t got %t", tc.rule, tc.raw, tc.expected, actual)
+		}
+	}
+}
+
+func TestEngineDeduplicatesAndCoolsDown(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]any
+		json.NewDecoder(req.Body).Decode(&body)
+		mu.Lock()
+		received = append(received, body)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	ceiling := 1000
+	engine := NewEngine(Config{
+		Cooldown: Duration(time.Hour),
+		Webhooks: []Webhook{{Name: "duty", URL: server.URL, Format: Slack}},
+		Rules:    []Rule{{Name: "low ceiling", Sites: []string{"CJY4"}, CeilingBelow: &ceiling}},
+	})
+	engine.client = &util.Client{HTTP: server.Client(), MaxBodySize: 1024}
+	now := ref
+	engine.now = func() time.Time { return now }
+
+	evaluate := func(raw string) int {
+		return len(engine.Evaluate(context.Background(), "CJY4", parse(t, raw)))
+	}
+
+	if sent := evaluate("METAR CJY4 250000Z 31012KT 15SM OVC008 21/05 A2992"); sent != 1 {
+		t.Fatalf("expected a notification when the ceiling drops got %d", sent)
+	}
+	// the same observation polled again, and the ceiling staying low
+	if sent := evaluate("METAR CJY4 250000Z 31012KT 15SM OVC008 21/05 A2992"); sent != 0 {
+		t.Fatalf("expected the repeated observation to be ignored got %d", sent)
+	}
+	if sent := evaluate("METAR CJY4 250100Z 31012KT 15SM OVC007 21/05 A2992"); sent != 0 {
+		t.Fatalf("expected no notification while the ceiling stays low got %d", sent)
+	}
+
+	// clearing and dropping again inside the cooldown
+	now = now.Add(30 * time.Minute)
+	evaluate("METAR CJY4 250200Z 31012KT 15SM BKN030 21/05 A2992")
+	if sent := evaluate("METAR CJY4 250300Z 31012KT 15SM OVC008 21/05 A2992"); sent != 0 {
+		t.Fatalf("expected no notification during the cooldown got %d", sent)
+	}
+
+	// still low once the cooldown is over
+	now = now.Add(time.Hour)
+	if sent := evaluate("METAR CJY4 250400Z 31012KT 15SM OVC009 21/05 A2992"); sent != 1 {
+		t.Fatalf("expected a notification after the cooldown got %d", sent)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected the webhook to receive 2 notifications got %d", len(received))
+	}
+	if _, ok := received[0]["text"]; !ok {
+		t.Fatalf("expected a slack payload got %v", received[0])
+	}
+}
+
+func TestEngineRetriesFailedNotifications(t *testing.T) {
+	var mu sync.Mutex
+	failing, received := true, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received++
+	}))
+	defer server.Close()
+
+	ceiling := 1000
+	engine := NewEngine(Config{
+		Webhooks: []Webhook{{Name: "duty", URL: server.URL, Format: Generic}},
+		Rules:    []Rule{{Name: "low ceiling", Sites: []string{"CJY4"}, CeilingBelow: &ceiling}},
+	})
+	engine.client = &util.Client{HTTP: server.Client(), MaxBodySize: 1024}
+
+	low := parse(t, "METAR CJY4 250000Z 31012KT 15SM OVC008 21/05 A2992")
+	if sent := engine.Evaluate(context.Background(), "CJY4", low); len(sent) != 0 {
+		t.Fatalf("expected nothing to be sent while the webhook fails got %d", len(sent))
+	}
+	if sent := engine.Retry(context.Background()); len(sent) != 0 {
+		t.Fatalf("expected the retry to fail too got %d", len(sent))
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+
+	if sent := engine.Retry(context.Background()); len(sent) != 1 {
+		t.Fatalf("expected the notification to be sent once the webhook recovers got %d", len(sent))
+	}
+	if sent := engine.Retry(context.Background()); len(sent) != 0 {
+		t.Fatalf("expected nothing left to retry got %d", len(sent))
+	}
+	if sent := engine.Evaluate(context.Background(), "CJY4", low); len(sent) != 0 {
+		t.Fatalf("expected the sent observation to be handled got %d", len(sent))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 1 {
+		t.Fatalf("expected the webhook to receive 1 notification got %d", received)
+	}
+}
+
+func TestConfigRequiresWebhooks(t *testing.T) {
+	config := Config{Rules: []Rule{{Name: "ifr", Sites: []string{"CYXE"}, Category: metar.IFR}}}
+	err := config.validate()
+	if err == nil {
+		t.Fatal("expected a rule with no webhooks to notify to be rejected")
+	}
+
+	config.Webhooks = []Webhook{{Name: "duty", URL: "http://localhost", Format: Slack}}
+	err = config.validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
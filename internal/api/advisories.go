@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"strings"
+	"time"
+)
+
+// advisoriesKey holds the SIGMETs and AIRMETs for every FIR, they're always pulled together
+var advisoriesKey = cache.Key{Source: scrape.NavCanadaSource, Product: cache.Advisories}
+
+// AdvisoriesResponse holds the SIGMETs and AIRMETs valid at a time
+type AdvisoriesResponse struct {
+	ValidAt    time.Time         `json:"valid_at"`
+	Advisories []scrape.Advisory `json:"advisories"`
+	Errors     scrape.SiteErrors `json:"errors"` // by FIR, the advisories that couldn't be decoded
+}
+
+// GetAdvisories returns the SIGMETs and AIRMETs valid at ?valid_at= (RFC 3339, now by default), only those of
+// ?kind= (sigmet, airmet or both by default) and only those covering any of ?sites= if given, advisories whose area
+// couldn't be decoded are always included. ?format=geojson returns a GeoJSON FeatureCollection with each advisory's
+// area as its geometry instead
+func GetAdvisories(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	kinds, err := parseAdvisoryKinds(query.Get("kind"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	positions, err := parsePositions(query.Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	validAt, err := parseTime(query.Get("valid_at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	format := strings.ToLower(query.Get("format"))
+	if format != "" && format != "json" && format != "geojson" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q, expected json or geojson", format))
+		return
+	}
+
+	all, err := advisories()
+	if err != nil && all == nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	res := AdvisoriesResponse{ValidAt: validAt.UTC(), Advisories: []scrape.Advisory{}, Errors: advisoryErrors(err)}
+	for _, advisory := range all {
+		if !slices.Contains(kinds, advisory.Kind) || !advisory.ValidAt(validAt) {
+			continue
+		}
+		if len(positions) > 0 && !advisory.Unlocated && !slices.ContainsFunc(positions, advisory.Polygon.Contains) {
+			continue
+		}
+		res.Advisories = append(res.Advisories, advisory)
+	}
+
+	if format == "geojson" {
+		var features []geo.Feature
+		for _, advisory := range res.Advisories {
+			geometry := advisory.Polygon.Geometry()
+			advisory.Polygon = nil
+			features = append(features, geo.NewFeature(geometry, advisory))
+		}
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(geo.NewFeatureCollection(features...))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseAdvisoryKinds parses a comma separated list of sigmet and airmet, both by default
+func parseAdvisoryKinds(param string) ([]scrape.Alpha, error) {
+	if strings.TrimSpace(param) == "" {
+		return []scrape.Alpha{scrape.Sigmet, scrape.Airmet}, nil
+	}
+
+	var res []scrape.Alpha
+	for _, raw := range strings.Split(param, ",") {
+		kind := scrape.Alpha(strings.ToLower(strings.TrimSpace(raw)))
+		if kind != scrape.Sigmet && kind != scrape.Airmet {
+			return nil, fmt.Errorf("unknown advisory kind %q, expected sigmet or airmet", raw)
+		}
+		res = append(res, kind)
+	}
+	return res, nil
+}
+
+// parsePositions looks up the position of each of a comma separated list of sites, none if param is empty
+func parsePositions(param string) ([]geo.Point, error) {
+	var res []geo.Point
+	var unknown []string
+	for _, raw := range strings.Split(param, ",") {
+		site := strings.ToUpper(strings.TrimSpace(raw))
+		if site == "" {
+			continue
+		}
+		position, ok := geo.Lookup(site)
+		if !ok {
+			unknown = append(unknown, site)
+			continue
+		}
+		res = append(res, position)
+	}
+	if len(unknown) > 0 {
+		return nil, &UnknownSitesError{Sites: unknown}
+	}
+	return res, nil
+}
+
+// advisories serves every SIGMET and AIRMET from the cache
+func advisories() ([]scrape.Advisory, error) {
+	found, err := fetchCached([]cache.Key{advisoriesKey}, func(ctx context.Context, _ []cache.Key) (map[cache.Key][]scrape.Advisory, error) {
+		return pullAdvisories(ctx)
+	})
+	return found[advisoriesKey], err
+}
+
+// advisoryErrors are the SiteErrors for the advisories in err that couldn't be decoded, anything else in err is an error
+// for every site advisories are requested for
+func advisoryErrors(err error) scrape.SiteErrors {
+	res, other := splitErrors(err)
+	if other != nil {
+		for _, site := range scrape.AdvisorySites {
+			res = append(res, scrape.NewSiteError(site, scrape.NavCanadaSource, other))
+		}
+	}
+	return res
+}
+
+// pullAdvisories requests every SIGMET and AIRMET upstream, keeping those that could be decoded even if some couldn't
+func pullAdvisories(ctx context.Context) (map[cache.Key][]scrape.Advisory, error) {
+	out, err := scrape.GetAdvisories(ctx, scrape.AdvisorySites...)
+	if out == nil && err != nil {
+		return nil, err
+	}
+	return map[cache.Key][]scrape.Advisory{advisoriesKey: out}, err
+}
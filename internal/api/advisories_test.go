@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"testing"
+	"time"
+)
+
+func TestGetAdvisories(t *testing.T) {
+	start := time.Date(2025, 6, 18, 18, 0, 0, 0, time.UTC)
+	around := func(site string) geo.Polygon { return geo.Circle(geo.Stations[site], 30) }
+	store.Set(advisoriesKey, []scrape.Advisory{
+		{Kind: scrape.Sigmet, Id: "D2", Hazard: "SEV TS", Convective: true, StartValidity: start, EndValidity: start.Add(4 * time.Hour), Polygon: around("CYXE")},
+		{Kind: scrape.Airmet, Id: "B1", Hazard: "MOD ICE", StartValidity: start, EndValidity: start.Add(4 * time.Hour), Polygon: around("CYVT")},
+		{Kind: scrape.Sigmet, Id: "D1", Hazard: "SEV TURB", StartValidity: start.Add(-4 * time.Hour), EndValidity: start},
+		{Kind: scrape.Airmet, Id: "B2", Hazard: "MOD TURB", StartValidity: start, EndValidity: start.Add(4 * time.Hour), Unlocated: true},
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		GetAdvisories(recorder, httptest.NewRequest(http.MethodGet, "/advisories?"+query, nil))
+		return recorder
+	}
+	ids := func(query string) []string {
+		res := getJSON[AdvisoriesResponse](t, GetAdvisories, "/advisories?"+query)
+		var ids []string
+		for _, advisory := range res.Advisories {
+			ids = append(ids, advisory.Id)
+		}
+		return ids
+	}
+
+	if actual := ids("valid_at=2025-06-18T19:00:00Z"); len(actual) != 3 {
+		t.Fatalf("expected the expired SIGMET to be left out got %v", actual)
+	}
+	if actual := ids("valid_at=2025-06-18T19:00:00Z&kind=sigmet"); len(actual) != 1 || actual[0] != "D2" {
+		t.Fatalf("expected only SIGMET D2 got %v", actual)
+	}
+	if actual := ids("valid_at=2025-06-18T19:00:00Z&sites=CYVT,CJL4"); len(actual) != 2 || actual[0] != "B1" || actual[1] != "B2" {
+		t.Fatalf("expected the AIRMET over CYVT and the one that can't be placed got %v", actual)
+	}
+
+	recorder := get("valid_at=2025-06-18T19:00:00Z&kind=sigmet&format=geojson")
+	if recorder.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("expected GeoJSON got %s", recorder.Header().Get("Content-Type"))
+	}
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string         `json:"type"`
+				Coordinates [][][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	err := json.NewDecoder(recorder.Body).Decode(&collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 1 {
+		t.Fatalf("expected a single feature got %+v", collection)
+	}
+	feature := collection.Features[0]
+	if feature.Geometry.Type != "Polygon" || feature.Properties["hazard"] != "SEV TS" || feature.Properties["polygon"] != nil {
+		t.Fatalf("expected the SIGMET's area as a polygon got %+v", feature)
+	}
+	// longitude comes first
+	if first := feature.Geometry.Coordinates[0][0]; first[0] > -100 || first[1] < 50 {
+		t.Fatalf("expected [lon, lat] got %v", first)
+	}
+
+	for _, query := range []string{"kind=pirep", "sites=NOWHERE", "format=kml", "valid_at=now"} {
+		if recorder := get(query); recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", query, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"scuffed-v2/internal/alert"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/stream"
+	"time"
+)
+
+// alerts is nil until LoadAlerts is called
+var alerts *alert.Engine
+
+// LoadAlerts evaluates the rules in the config file at path against every new observation the poller sees
+func LoadAlerts(path string) error {
+	config, err := alert.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	alerts = alert.NewEngine(config)
+	return nil
+}
+
+// alertTimeout is the longest sending the notifications for an observation can take
+const alertTimeout = 30 * time.Second
+
+// evaluateAlerts checks each new observation in events against the alert rules and retries any notifications that
+// couldn't be sent before. It returns straight away so a slow webhook doesn't hold up polling, sending has its own
+// timeout rather than ctx's
+func evaluateAlerts(ctx context.Context, events []stream.Event) {
+	if alerts == nil {
+		return
+	}
+
+	deliver := func(send func(context.Context)) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), alertTimeout)
+		defer cancel()
+		send(ctx)
+	}
+
+	go func() {
+		deliver(func(ctx context.Context) { alerts.Retry(ctx) })
+		for _, event := range events {
+			if obs, ok := event.Data.(metar.Observation); ok {
+				deliver(func(ctx context.Context) { alerts.Evaluate(ctx, event.Site, obs) })
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/scrape"
+	"testing"
+)
+
+// getJSON requests url from handler, failing t unless it responds 200 with a body that decodes into T
+func getJSON[T any](t *testing.T, handler http.HandlerFunc, url string) T {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s: expected 200 got %d %s", url, recorder.Code, recorder.Body)
+	}
+
+	var res T
+	err := json.NewDecoder(recorder.Body).Decode(&res)
+	if err != nil {
+		t.Fatalf("%s: %v", url, err)
+	}
+	return res
+}
+
+func TestFetchBySite(t *testing.T) {
+	key := func(site string) cache.Key {
+		return cache.Key{Source: "fetch-by-site", Site: site, Product: cache.Notams}
+	}
+	garbled := &scrape.SiteError{Site: "CYXE", Kind: scrape.ErrParse, Message: "garbled"}
+	pull := func(ctx context.Context, sites []string) (map[cache.Key]string, error) {
+		return map[cache.Key]string{key("CYXE"): "CYXE"}, errors.Join(scrape.SiteErrors{garbled}, errors.New("down"))
+	}
+
+	found, errs := fetchBySite("test", []string{"CYXE", "CYVT"}, key, pull)
+	if len(found) != 1 || found["CYXE"] != "CYXE" {
+		t.Fatalf("expected CYXE's value got %v", found)
+	}
+	if len(errs) != 2 || errs[0] != garbled || errs[1].Site != "CYVT" || errs[1].Message != "down" {
+		t.Fatalf("expected CYXE's parse error to be kept and CYVT to be down got %v", errs)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/scrape"
+	"scuffed-v2/internal/winds"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTrueAirspeed is used to estimate the time en route when ?tas= isn't given, knots
+	defaultTrueAirspeed = 120
+	// briefingCorridor is how close to the route in nautical miles a SIGMET or AIRMET has to be to be included
+	briefingCorridor = 25
+)
+
+// BriefingLeg is the flight between two consecutive waypoints
+type BriefingLeg struct {
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Distance float64 `json:"distance"` // nm
+	Course   float64 `json:"course"`   // degrees true
+	// Winds are estimated at the leg's midpoint at the time it'd be reached with no wind, nil if there's no estimate
+	// and GroundSpeed is the true airspeed
+	Winds       *winds.Conditions `json:"winds"`
+	GroundSpeed float64           `json:"ground_speed"` // knots
+	Minutes     float64           `json:"minutes"`
+}
+
+// BriefingWaypoint is the weather expected at a waypoint when it's reached
+type BriefingWaypoint struct {
+	Site     string    `json:"site"`
+	Position geo.Point `json:"position"`
+	ETA      time.Time `json:"eta"`
+	// Observation is the latest METAR, nil if the site has none
+	Observation *metar.Observation `json:"observation"`
+	// Forecast is from the latest TAF at ETA, nil if the site has no TAF or it doesn't cover ETA
+	Forecast *metar.Forecast      `json:"forecast"`
+	Category metar.FlightCategory `json:"forecast_category,omitempty"`
+	Winds    *winds.Estimate      `json:"winds"` // at the briefing's altitude
+	GFA      *RegionFrames        `json:"gfa"`   // the frames valid at ETA of the region covering the site
+}
+
+// BriefingResponse holds everything known about the weather along a route, along with why anything is missing
+type BriefingResponse struct {
+	Route        []string           `json:"route"`
+	Altitude     int                `json:"altitude"`
+	TrueAirspeed int                `json:"true_airspeed"`
+	ETD          time.Time          `json:"etd"`
+	ETA          time.Time          `json:"eta"`
+	Legs         []BriefingLeg      `json:"legs"`
+	Waypoints    []BriefingWaypoint `json:"waypoints"`
+	// Advisories are the SIGMETs and AIRMETs within briefingCorridor of the route valid at any time between ETD and ETA,
+	// along with those valid then whose area couldn't be decoded, which are marked unlocated
+	Advisories []scrape.Advisory `json:"advisories"`
+	Errors     scrape.SiteErrors `json:"errors"`
+}
+
+// GetBriefing returns the weather along ?route= (a comma separated list of at least two sites) flown at ?alt= (feet)
+// leaving at ?etd= (RFC 3339, now by default) at ?tas= (knots, 120 by default). Each waypoint has its METAR, TAF, winds
+// and GFA frames at its ETA, found from the winds along each leg
+func GetBriefing(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	route, positions, err := parseRoute(query.Get("route"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	altitude, err := strconv.Atoi(query.Get("alt"))
+	if err != nil || altitude < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("alt must be a positive altitude in feet, got %q", query.Get("alt")))
+		return
+	}
+
+	etd, err := parseTime(query.Get("etd"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	trueAirspeed := defaultTrueAirspeed
+	if param := query.Get("tas"); param != "" {
+		trueAirspeed, err = strconv.Atoi(param)
+		if err != nil || trueAirspeed <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("tas must be a positive speed in knots, got %q", param))
+			return
+		}
+	}
+
+	var sites []string
+	for _, site := range route {
+		if !slices.Contains(sites, site) {
+			sites = append(sites, site)
+		}
+	}
+
+	res := BriefingResponse{
+		Route:        route,
+		Altitude:     altitude,
+		TrueAirspeed: trueAirspeed,
+		ETD:          etd.UTC(),
+		Legs:         []BriefingLeg{},
+		Waypoints:    []BriefingWaypoint{},
+		Advisories:   []scrape.Advisory{},
+	}
+
+	forecasts, windsErr := upperWinds(routeWindStations(positions))
+
+	etas := make([]time.Time, len(route))
+	etas[0] = res.ETD
+	for i := 0; i+1 < len(route); i++ {
+		leg, legErr := briefingLeg(route[i], route[i+1], positions[i], positions[i+1], forecasts, altitude, float64(trueAirspeed), etas[i])
+		if legErr != nil {
+			res.Errors = append(res.Errors, legErr)
+		}
+		res.Legs = append(res.Legs, leg)
+		etas[i+1] = etas[i].Add(time.Duration(leg.Minutes * float64(time.Minute))).Round(time.Minute)
+	}
+	res.ETA = etas[len(etas)-1]
+
+	reports, errs := weatherReports(sites)
+	res.Errors = append(res.Errors, errs...)
+
+	regions, errs := regionalGFA(sites)
+	res.Errors = append(res.Errors, errs...)
+
+	for i, site := range route {
+		waypoint := BriefingWaypoint{Site: site, Position: positions[i], ETA: etas[i]}
+
+		if j := slices.IndexFunc(reports, func(report *scrape.WeatherReport) bool { return report.Airport == site }); j >= 0 {
+			waypoint.Observation = reports[j].LatestObservation()
+			if taf := reports[j].LatestForecast(); taf != nil {
+				if forecast, ok := taf.At(waypoint.ETA); ok {
+					waypoint.Forecast = &forecast
+					waypoint.Category = forecast.Prevailing.FlightCategory()
+				}
+			}
+		}
+
+		estimate, err := winds.Interpolate(forecasts, waypoint.Position, altitude, waypoint.ETA)
+		switch {
+		case err == nil:
+			waypoint.Winds = &estimate
+		case windsErr != nil:
+			res.Errors = append(res.Errors, scrape.NewSiteError(site, scrape.NavCanadaSource, windsErr))
+		default:
+			res.Errors = append(res.Errors, &scrape.SiteError{Site: site, Source: scrape.NavCanadaSource, Kind: scrape.ErrNoData, Message: err.Error(), Err: err})
+		}
+
+		if j := slices.IndexFunc(regions, func(gfa scrape.GFA) bool { return slices.Contains(gfa.Sites, site) }); j >= 0 {
+			gfa := withImageURLs(regions[j])
+			latest, previous := gfa.At(waypoint.ETA)
+			waypoint.GFA = &RegionFrames{Region: gfa.Region, Sites: gfa.Sites, Latest: latest, Previous: previous}
+		}
+
+		res.Waypoints = append(res.Waypoints, waypoint)
+	}
+
+	all, err := advisories()
+	if err != nil && all == nil {
+		for _, site := range sites {
+			res.Errors = append(res.Errors, scrape.NewSiteError(site, scrape.NavCanadaSource, err))
+		}
+	} else {
+		res.Errors = append(res.Errors, advisoryErrors(err)...)
+	}
+	corridor := geo.Corridor(positions, briefingCorridor)
+	for _, advisory := range all {
+		if advisory.StartValidity.After(res.ETA) || !advisory.EndValidity.After(res.ETD) {
+			continue
+		}
+		// an advisory that can't be placed could be over the route
+		if advisory.Unlocated || advisory.Polygon.Intersects(corridor) {
+			res.Advisories = append(res.Advisories, advisory)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseRoute parses a comma separated list of at least two sites with known positions, in the order they're flown,
+// along with their positions
+func parseRoute(param string) ([]string, []geo.Point, error) {
+	var res, unknown []string
+	var positions []geo.Point
+	for _, raw := range strings.Split(param, ",") {
+		site := strings.ToUpper(strings.TrimSpace(raw))
+		if site == "" {
+			continue
+		}
+		position, ok := geo.Lookup(site)
+		if !ok {
+			unknown = append(unknown, site)
+			continue
+		}
+		res = append(res, site)
+		positions = append(positions, position)
+	}
+
+	if len(unknown) > 0 {
+		return nil, nil, &UnknownSitesError{Sites: unknown}
+	}
+	if len(res) < 2 {
+		return nil, nil, errors.New("route must have at least two sites e.g. CYXE,CYVT")
+	}
+	return res, positions, nil
+}
+
+// routeWindStations are the upper wind stations needed to estimate the winds at each of positions and the midpoints
+// between them
+func routeWindStations(positions []geo.Point) []string {
+	var res []string
+	add := func(position geo.Point) {
+		for _, station := range nearestStations(position, scrape.UpperWindStations, nearestWindStations) {
+			if !slices.Contains(res, station) {
+				res = append(res, station)
+			}
+		}
+	}
+
+	for i, position := range positions {
+		add(position)
+		if i+1 < len(positions) {
+			add(midpoint(position, positions[i+1]))
+		}
+	}
+	return res
+}
+
+// briefingLeg works out the leg from one site at a to another at b leaving at departure from the winds at its midpoint
+// when it's reached with no wind, falling back to no wind if they can't be estimated or are too strong to fly through
+func briefingLeg(from, to string, a, b geo.Point, forecasts []scrape.AirportWinds, altitude int, trueAirspeed float64, departure time.Time) (BriefingLeg, *scrape.SiteError) {
+	distance, course := geo.Distance(a, b), geo.Bearing(a, b)
+	leg := BriefingLeg{From: from, To: to, Distance: math.Round(distance*10) / 10, Course: math.Round(course), GroundSpeed: trueAirspeed}
+
+	var legErr *scrape.SiteError
+	halfway := departure.Add(time.Duration(distance / trueAirspeed / 2 * float64(time.Hour)))
+	if estimate, err := winds.Interpolate(forecasts, midpoint(a, b), altitude, halfway); err == nil {
+		leg.Winds = &estimate.Conditions
+		groundSpeed, err := winds.GroundSpeed(trueAirspeed, course, estimate.Conditions)
+		if err == nil {
+			leg.GroundSpeed = groundSpeed
+		} else {
+			legErr = &scrape.SiteError{Site: to, Kind: scrape.ErrNoData, Message: fmt.Sprintf("leg from %s: %s", from, err), Err: err}
+		}
+	}
+
+	leg.Minutes = math.Round(distance/leg.GroundSpeed*60*10) / 10
+	leg.GroundSpeed = math.Round(leg.GroundSpeed)
+	return leg, legErr
+}
+
+func midpoint(a, b geo.Point) geo.Point {
+	return geo.Destination(a, geo.Bearing(a, b), geo.Distance(a, b)/2)
+}
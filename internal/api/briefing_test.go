@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetBriefing(t *testing.T) {
+	etd := time.Date(2025, 6, 24, 20, 0, 0, 0, time.UTC)
+	route := []geo.Point{geo.Stations["CYXE"], geo.Stations["CYVT"]}
+
+	tafs := map[string]string{
+		"CYXE": "TAF CYXE 241740Z 2418/2518 27010KT P6SM FEW040 BKN100",
+		"CYVT": "TAF CYVT 241740Z 2418/2506 32010KT 3SM -RA OVC015",
+	}
+	for site, raw := range tafs {
+		taf, err := metar.ParseTAF(raw, etd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := &scrape.WeatherReport{Airport: site, Taf: []string{raw}, Forecasts: []metar.TAF{taf}}
+		for _, source := range scrape.Sources() {
+			if slices.Contains(source.SupportedSites(), site) {
+				store.Set(metarKey(source.Name(), site), report)
+			}
+		}
+		store.Set(gfaKey(site), []scrape.GFA{{
+			Region:        "GFACN32",
+			CloudsWeather: []scrape.GFAMetadata{{Id: "1", StartValidity: etd.Add(-2 * time.Hour), EndValidity: etd.Add(4 * time.Hour)}},
+		}})
+	}
+
+	p := func(v int) *int { return &v }
+	for _, station := range routeWindStations(route) {
+		store.Set(windsKey(station), scrape.AirportWinds{AirportCode: station, Low: []scrape.Wind{{
+			Data: []scrape.ElevationValues{
+				{Elevation: 6000, Direction: p(270), Speed: p(30), Temperature: p(5)},
+				{Elevation: 9000, Direction: p(270), Speed: p(30), Temperature: p(-1)},
+			},
+			Valid:       etd,
+			ForUseStart: etd.Add(-6 * time.Hour),
+			ForUseEnd:   etd.Add(6 * time.Hour),
+		}}})
+	}
+
+	store.Set(advisoriesKey, []scrape.Advisory{
+		{Id: "D1", Polygon: geo.Circle(geo.Stations["CYVT"], 30), StartValidity: etd, EndValidity: etd.Add(4 * time.Hour)},
+		{Id: "D2", Polygon: geo.Circle(geo.Stations["CYQR"], 30), StartValidity: etd, EndValidity: etd.Add(4 * time.Hour)},
+		{Id: "D3", Polygon: geo.Circle(geo.Stations["CYXE"], 30), StartValidity: etd.Add(-4 * time.Hour), EndValidity: etd},
+		{Id: "D4", StartValidity: etd, EndValidity: etd.Add(4 * time.Hour), Unlocated: true},
+		{Id: "D5", StartValidity: etd.Add(-4 * time.Hour), EndValidity: etd, Unlocated: true},
+	})
+
+	res := getJSON[BriefingResponse](t, GetBriefing, "/briefing?route=CYXE,CYVT&alt=8500&etd=2025-06-24T20:00:00Z")
+
+	// heading north west into a westerly
+	if len(res.Legs) != 1 || res.Legs[0].Winds == nil || res.Legs[0].GroundSpeed >= defaultTrueAirspeed {
+		t.Fatalf("expected a headwind to slow the leg got %+v", res.Legs)
+	}
+	if len(res.Waypoints) != 2 || !res.Waypoints[0].ETA.Equal(etd) || !res.Waypoints[1].ETA.Equal(res.ETA) || !res.ETA.After(etd) {
+		t.Fatalf("expected to arrive at CYVT after leaving CYXE got %+v", res.Waypoints)
+	}
+
+	cyvt := res.Waypoints[1]
+	if cyvt.Forecast == nil || cyvt.Category != metar.MVFR {
+		t.Fatalf("expected CYVT's TAF at its ETA to be MVFR got %+v", cyvt)
+	}
+	if cyvt.Winds == nil || cyvt.Winds.Direction != 270 || cyvt.Winds.Speed != 30 {
+		t.Fatalf("expected 270@30 over CYVT got %+v", cyvt.Winds)
+	}
+	if cyvt.GFA == nil || cyvt.GFA.Latest.CloudsWeather == nil || cyvt.GFA.Latest.CloudsWeather.URL != "/gfa/cldwx/1.png" {
+		t.Fatalf("expected CYVT's GFA frame got %+v", cyvt.GFA)
+	}
+
+	if len(res.Advisories) != 2 || res.Advisories[0].Id != "D1" || res.Advisories[1].Id != "D4" || !res.Advisories[1].Unlocated {
+		t.Fatalf("expected the advisory over the route and the one that can't be placed while flying it got %+v", res.Advisories)
+	}
+	if len(res.Errors) != 0 {
+		t.Fatalf("expected no errors got %v", res.Errors)
+	}
+
+	for _, query := range []string{"route=CYXE&alt=8500", "route=CYXE,XXXX&alt=8500", "route=CYXE,CYVT", "route=CYXE,CYVT&alt=8500&tas=0"} {
+		recorder := httptest.NewRecorder()
+		GetBriefing(recorder, httptest.NewRequest(http.MethodGet, "/briefing?"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", query, recorder.Code)
+		}
+	}
+}
+
+func TestBriefingLegWindsAtMidpoint(t *testing.T) {
+	departure := time.Date(2025, 6, 24, 20, 0, 0, 0, time.UTC)
+	a, b := geo.Stations["CYXE"], geo.Stations["CYVT"]
+
+	p := func(v int) *int { return &v }
+	forecast := func(direction int, start, end time.Time) scrape.Wind {
+		return scrape.Wind{
+			Data:        []scrape.ElevationValues{{Elevation: 9000, Direction: p(direction), Speed: p(30), Temperature: p(-1)}},
+			Valid:       start,
+			ForUseStart: start,
+			ForUseEnd:   end,
+		}
+	}
+
+	// the forecast in use at departure is replaced by the time the midpoint is reached
+	var forecasts []scrape.AirportWinds
+	for _, station := range routeWindStations([]geo.Point{a, b}) {
+		forecasts = append(forecasts, scrape.AirportWinds{AirportCode: station, Low: []scrape.Wind{
+			forecast(90, departure.Add(-6*time.Hour), departure.Add(10*time.Minute)),
+			forecast(270, departure.Add(10*time.Minute), departure.Add(6*time.Hour)),
+		}})
+	}
+
+	leg, err := briefingLeg("CYXE", "CYVT", a, b, forecasts, 9000, defaultTrueAirspeed, departure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leg.Winds == nil || leg.Winds.Direction != 270 {
+		t.Fatalf("expected the winds when the midpoint is reached got %+v", leg.Winds)
+	}
+}
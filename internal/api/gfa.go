@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"maps"
+	"net/http"
+	"regexp"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/scrape"
+	"scuffed-v2/internal/util"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	cloudsImage     = "cldwx"
+	turbulenceImage = "turbc"
+
+	// gfaImageRetention is how long images are kept on disk, GFAs are valid for at most a day after they're issued
+	gfaImageRetention = 48 * time.Hour
+)
+
+var gfaImageId = regexp.MustCompile(`^\d+$`)
+
+// gfaImages is nil until OpenGFAImages is called, images are proxied without being kept on disk without it
+var gfaImages *cache.Disk
+
+// OpenGFAImages keeps every GFA image served in dir
+func OpenGFAImages(dir string) error {
+	disk, err := cache.NewDisk(dir)
+	if err != nil {
+		return err
+	}
+	gfaImages = disk
+	return nil
+}
+
+// defaultGFARegions is what /gfa returns when no regions or sites are given
+var defaultGFARegions = []string{"GFACN32"}
+
+var icaoSite = regexp.MustCompile(`^[A-Z0-9]{4}$`)
+
+func gfaKey(site string) cache.Key {
+	return cache.Key{Source: scrape.NavCanadaSource, Site: site, Product: cache.GFA}
+}
+
+// GFAResponse holds the GFA for every region covering the requested sites, along with why any sites don't have one
+type GFAResponse struct {
+	Regions []scrape.GFA      `json:"regions"`
+	Errors  scrape.SiteErrors `json:"errors"`
+}
+
+// GetGFA returns the GFA for each of ?region= (e.g. GFACN32) or the regions covering ?sites=, GFACN32 by default
+func GetGFA(w http.ResponseWriter, req *http.Request) {
+	sites, err := parseGFASites(req.URL.Query().Get("region"), req.URL.Query().Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	regions, errs := regionalGFA(sites)
+	res := GFAResponse{Regions: []scrape.GFA{}, Errors: errs}
+	for _, gfa := range regions {
+		res.Regions = append(res.Regions, withImageURLs(gfa))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// RegionFrames are the frames of a region's GFA valid at a time
+type RegionFrames struct {
+	Region string           `json:"region"`
+	Sites  []string         `json:"sites,omitempty"`
+	Latest scrape.GFAFrames `json:"latest"`
+	// Previous is from the issuance before Latest's for comparison
+	Previous scrape.GFAFrames `json:"previous"`
+}
+
+// GFAFramesResponse holds the frames valid at a time for every region covering the requested sites
+type GFAFramesResponse struct {
+	ValidAt time.Time         `json:"valid_at"`
+	Regions []RegionFrames    `json:"regions"`
+	Errors  scrape.SiteErrors `json:"errors"`
+}
+
+// GetGFAFrames returns the clouds and weather and icing and turbulence frames valid at ?valid_at= (RFC 3339, now by
+// default) from the latest and previous issuance, for the regions selected the same way as GetGFA
+func GetGFAFrames(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	sites, err := parseGFASites(query.Get("region"), query.Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	validAt, err := parseTime(query.Get("valid_at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	regions, errs := regionalGFA(sites)
+	res := GFAFramesResponse{ValidAt: validAt.UTC(), Regions: []RegionFrames{}, Errors: errs}
+	for _, gfa := range regions {
+		gfa = withImageURLs(gfa)
+		latest, previous := gfa.At(validAt)
+		res.Regions = append(res.Regions, RegionFrames{Region: gfa.Region, Sites: gfa.Sites, Latest: latest, Previous: previous})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseGFASites returns the sites to request GFAs for from a comma separated list of regions or sites
+func parseGFASites(regionParam, sitesParam string) ([]string, error) {
+	split := func(param string) []string {
+		var res []string
+		for _, raw := range strings.Split(param, ",") {
+			if value := strings.ToUpper(strings.TrimSpace(raw)); value != "" && !slices.Contains(res, value) {
+				res = append(res, value)
+			}
+		}
+		return res
+	}
+
+	regions, sites := split(regionParam), split(sitesParam)
+	if len(regions) > 0 && len(sites) > 0 {
+		return nil, errors.New("only one of region or sites can be given")
+	}
+	if len(regions) == 0 && len(sites) == 0 {
+		regions = defaultGFARegions
+	}
+
+	var res, unknown []string
+	for _, region := range regions {
+		if site, ok := scrape.GFARegions[region]; ok {
+			res = append(res, site)
+		} else {
+			unknown = append(unknown, region)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown GFA regions %s, expected GFACN31 to GFACN37", strings.Join(unknown, ", "))
+	}
+
+	for _, site := range sites {
+		if icaoSite.MatchString(site) {
+			res = append(res, site)
+		} else {
+			unknown = append(unknown, site)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &UnknownSitesError{Sites: unknown}
+	}
+
+	return res, nil
+}
+
+// regionalGFA serves the GFA covering each site from the cache, combining sites in the same region
+func regionalGFA(sites []string) ([]scrape.GFA, scrape.SiteErrors) {
+	found, errs := fetchBySite(scrape.NavCanadaSource, sites, gfaKey, pullGFA)
+
+	var res []scrape.GFA
+	for _, site := range sites {
+		gfas, ok := found[site]
+		if !ok {
+			continue
+		}
+		if len(gfas) == 0 {
+			errs = append(errs, &scrape.SiteError{Site: site, Source: scrape.NavCanadaSource, Kind: scrape.ErrNoData, Message: "no GFA covers the site"})
+			continue
+		}
+
+		for _, gfa := range gfas {
+			i := slices.IndexFunc(res, func(existing scrape.GFA) bool { return existing.Region == gfa.Region })
+			if i < 0 {
+				gfa.Sites = []string{site}
+				res = append(res, gfa)
+			} else if !slices.Contains(res[i].Sites, site) {
+				res[i].Sites = append(slices.Clone(res[i].Sites), site)
+			}
+		}
+	}
+
+	return res, errs
+}
+
+// pullGFA requests the GFA covering each of sites upstream
+func pullGFA(ctx context.Context, sites []string) (map[cache.Key][]scrape.GFA, error) {
+	gfas, err := scrape.GetGFAImageIds(ctx, sites...)
+	res, placeErr := placeGFA(sites, gfas)
+	return res, errors.Join(err, placeErr)
+}
+
+// placeGFA keys each of gfas by the requested sites it covers
+func placeGFA(sites []string, gfas []scrape.GFA) (map[cache.Key][]scrape.GFA, error) {
+	var err error
+	res := make(map[cache.Key][]scrape.GFA)
+	for _, gfa := range gfas {
+		covered := gfa.Sites
+		if len(covered) == 0 {
+			// not every response says which site a chart was for, it can only be placed by its region's site or if
+			// there's only one site it could be for
+			site, ok := scrape.GFARegions[gfa.Region]
+			switch {
+			case ok && slices.Contains(sites, site):
+				covered = []string{site}
+			case len(sites) == 1:
+				covered = sites
+			default:
+				err = errors.Join(err, fmt.Errorf("GFA %q doesn't say which site it covers", gfa.Region))
+			}
+		}
+		for _, site := range covered {
+			res[gfaKey(site)] = append(res[gfaKey(site)], gfa)
+		}
+	}
+	return res, err
+}
+
+// withImageURLs returns a copy of gfa with the URL of each frame's image set, the cached value is left as is
+func withImageURLs(gfa scrape.GFA) scrape.GFA {
+	withURLs := func(frames []scrape.GFAMetadata, imageType string) []scrape.GFAMetadata {
+		res := slices.Clone(frames)
+		for i := range res {
+			res[i].URL = fmt.Sprintf("/gfa/%s/%s.png", imageType, res[i].Id)
+		}
+		return res
+	}
+
+	gfa.CloudsWeather = withURLs(gfa.CloudsWeather, cloudsImage)
+	gfa.IcingTurbulenceFreezing = withURLs(gfa.IcingTurbulenceFreezing, turbulenceImage)
+	if gfa.Previous != nil {
+		gfa.Previous = &scrape.GFAIssuance{
+			CloudsWeather:           withURLs(gfa.Previous.CloudsWeather, cloudsImage),
+			IcingTurbulenceFreezing: withURLs(gfa.Previous.IcingTurbulenceFreezing, turbulenceImage),
+		}
+	}
+	return gfa
+}
+
+// GetGFAImage serves the GFA image /gfa/{type}/{id}.png from disk, downloading it from NavCanada the first time if it
+// is a frame of that type in the latest or previous GFA. Images never change once published so clients can cache them
+// forever
+func GetGFAImage(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	imageType, id := vars["type"], vars["id"]
+	if imageType != cloudsImage && imageType != turbulenceImage {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown GFA type %q, expected %s or %s", imageType, cloudsImage, turbulenceImage))
+		return
+	}
+	if !gfaImageId.MatchString(id) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid GFA image id %q", id))
+		return
+	}
+
+	fetch := detached(func(ctx context.Context) ([]byte, error) {
+		// NavCanada serves images by id alone, so make sure it is a frame of the requested type first
+		if !isGFAFrame(imageType, id) {
+			return nil, errUnknownGFAImage
+		}
+		return scrape.GetGFAImage(ctx, id)
+	})
+
+	var data []byte
+	var stored time.Time
+	var err error
+	if gfaImages != nil {
+		data, stored, err = gfaImages.Fetch(imageType+"-"+id+".png", fetch)
+	} else {
+		data, err = fetch()
+		stored = time.Now()
+	}
+
+	var statusErr *util.StatusError
+	switch {
+	case errors.Is(err, errUnknownGFAImage), errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no %s GFA image %s", imageType, id))
+		return
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+id+`"`)
+	http.ServeContent(w, req, id+".png", stored, bytes.NewReader(data))
+}
+
+var errUnknownGFAImage = errors.New("not a GFA frame")
+
+// isGFAFrame reports whether id is one of the imageType frames of any region's latest or previous GFA
+func isGFAFrame(imageType, id string) bool {
+	regions, _ := regionalGFA(slices.Collect(maps.Values(scrape.GFARegions)))
+	for _, gfa := range regions {
+		var frames []scrape.GFAMetadata
+		if imageType == cloudsImage {
+			frames = gfa.CloudsWeather
+			if gfa.Previous != nil {
+				frames = slices.Concat(frames, gfa.Previous.CloudsWeather)
+			}
+		} else {
+			frames = gfa.IcingTurbulenceFreezing
+			if gfa.Previous != nil {
+				frames = slices.Concat(frames, gfa.Previous.IcingTurbulenceFreezing)
+			}
+		}
+		if slices.ContainsFunc(frames, func(frame scrape.GFAMetadata) bool { return frame.Id == id }) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"github.com/gorilla/mux"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWithImageURLs(t *testing.T) {
+	gfa := scrape.GFA{
+		Region:                  "GFACN32",
+		CloudsWeather:           []scrape.GFAMetadata{{Id: "56716267"}},
+		IcingTurbulenceFreezing: []scrape.GFAMetadata{{Id: "56716275"}},
+		Previous:                &scrape.GFAIssuance{CloudsWeather: []scrape.GFAMetadata{{Id: "56716200"}}},
+	}
+
+	res := withImageURLs(gfa)
+	if res.CloudsWeather[0].URL != "/gfa/cldwx/56716267.png" || res.IcingTurbulenceFreezing[0].URL != "/gfa/turbc/56716275.png" {
+		t.Fatalf("expected image URLs got %+v", res)
+	}
+	if res.Region != "GFACN32" || res.Previous.CloudsWeather[0].URL != "/gfa/cldwx/56716200.png" {
+		t.Fatalf("expected the region and previous issuance to be kept got %+v", res)
+	}
+	if gfa.CloudsWeather[0].URL != "" || gfa.Previous.CloudsWeather[0].URL != "" {
+		t.Fatal("expected the original GFA to be left as is")
+	}
+}
+
+func TestGetGFAImage(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\n")
+	err := os.WriteFile(filepath.Join(dir, "cldwx-56716267.png"), png, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = OpenGFAImages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { gfaImages = nil }()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/gfa/{type}/{id:[0-9]+}.png", GetGFAImage)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/gfa/cldwx/56716267.png", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != string(png) {
+		t.Fatalf("expected the image from disk got %d %q", recorder.Code, recorder.Body)
+	}
+	if recorder.Header().Get("Content-Type") != "image/png" || recorder.Header().Get("Cache-Control") == "" {
+		t.Fatalf("expected png cache headers got %v", recorder.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/gfa/cldwx/56716267.png", nil)
+	req.Header.Set("If-None-Match", recorder.Header().Get("ETag"))
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusNotModified {
+		t.Fatalf("expected a cached image to not be modified got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/gfa/radar/56716267.png", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected an unknown type to be not found got %d", recorder.Code)
+	}
+
+	// an icing and turbulence chart isn't served as clouds and weather
+	for _, site := range scrape.GFARegions {
+		store.Set(gfaKey(site), []scrape.GFA{{Region: "GFACN32", IcingTurbulenceFreezing: []scrape.GFAMetadata{{Id: "56716275"}}}})
+	}
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/gfa/cldwx/56716275.png", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected a turbulence image to be not found as clouds got %d", recorder.Code)
+	}
+}
+
+func TestParseGFASites(t *testing.T) {
+	sites, err := parseGFASites("gfacn33, GFACN32", "")
+	if err != nil || !slices.Equal(sites, []string{"CYOW", "CYXE"}) {
+		t.Fatalf("expected each region's site got %v %v", sites, err)
+	}
+
+	sites, err = parseGFASites("", "")
+	if err != nil || !slices.Equal(sites, []string{"CYXE"}) {
+		t.Fatalf("expected GFACN32 by default got %v %v", sites, err)
+	}
+
+	if _, err = parseGFASites("GFACN38", ""); err == nil {
+		t.Fatal("expected an unknown region to be rejected")
+	}
+	if _, err = parseGFASites("", "CYXE,SASKATOON"); err == nil {
+		t.Fatal("expected an invalid site to be rejected")
+	}
+	if _, err = parseGFASites("GFACN32", "CYXE"); err == nil {
+		t.Fatal("expected region and sites together to be rejected")
+	}
+}
+
+func TestRegionalGFA(t *testing.T) {
+	prairies := scrape.GFA{Region: "GFACN32", Sites: []string{"CYXE"}, CloudsWeather: []scrape.GFAMetadata{{Id: "1"}}}
+	store.Set(gfaKey("CYXE"), []scrape.GFA{prairies})
+	store.Set(gfaKey("CYQR"), []scrape.GFA{prairies})
+	store.Set(gfaKey("CYZF"), []scrape.GFA{})
+
+	regions, errs := regionalGFA([]string{"CYXE", "CYQR", "CYZF"})
+	if len(regions) != 1 || !slices.Equal(regions[0].Sites, []string{"CYXE", "CYQR"}) {
+		t.Fatalf("expected CYXE and CYQR to share GFACN32 got %+v", regions)
+	}
+	if len(errs) != 1 || errs[0].Site != "CYZF" {
+		t.Fatalf("expected CYZF to have no GFA got %+v", errs)
+	}
+}
+
+func TestGetGFAFrames(t *testing.T) {
+	frame := func(id string, start int) scrape.GFAMetadata {
+		issued := time.Date(2025, 5, 18, 0, 0, 0, 0, time.UTC)
+		return scrape.GFAMetadata{Id: id, StartValidity: issued.Add(time.Duration(start) * time.Hour), EndValidity: issued.Add(time.Duration(start+6) * time.Hour)}
+	}
+	store.Set(gfaKey("CYXE"), []scrape.GFA{{
+		Region:                  "GFACN32",
+		CloudsWeather:           []scrape.GFAMetadata{frame("1", 0), frame("2", 6), frame("3", 12)},
+		IcingTurbulenceFreezing: []scrape.GFAMetadata{frame("4", 0), frame("5", 6), frame("6", 12)},
+		Previous: &scrape.GFAIssuance{
+			CloudsWeather:           []scrape.GFAMetadata{frame("7", -6), frame("8", 0), frame("9", 6)},
+			IcingTurbulenceFreezing: []scrape.GFAMetadata{frame("10", -6), frame("11", 0), frame("12", 6)},
+		},
+	}})
+
+	res := getJSON[GFAFramesResponse](t, GetGFAFrames, "/gfa/frames?region=GFACN32&valid_at=2025-05-18T15:00:00Z")
+
+	if len(res.Regions) != 1 {
+		t.Fatalf("expected GFACN32 got %+v", res)
+	}
+	region := res.Regions[0]
+	if region.Latest.CloudsWeather.Id != "3" || region.Latest.IcingTurbulenceFreezing.URL != "/gfa/turbc/6.png" {
+		t.Fatalf("expected the 12Z frames got %+v", region.Latest)
+	}
+	if region.Previous.CloudsWeather != nil || region.Previous.IcingTurbulenceFreezing != nil {
+		t.Fatalf("expected the previous issuance to not cover 15Z got %+v", region.Previous)
+	}
+
+	recorder := httptest.NewRecorder()
+	GetGFAFrames(recorder, httptest.NewRequest(http.MethodGet, "/gfa/frames?valid_at=tomorrow", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid time to be rejected got %d", recorder.Code)
+	}
+}
+
+func TestPlaceGFA(t *testing.T) {
+	sites := slices.Sorted(maps.Values(scrape.GFARegions))
+	res, err := placeGFA(sites, []scrape.GFA{
+		{Region: "GFACN32", Sites: []string{"CYXE"}},
+		{Region: "GFACN31"},
+		{},
+	})
+	if err == nil {
+		t.Fatal("expected an error for the GFA that can't be placed")
+	}
+	if len(res) != 2 || len(res[gfaKey("CYXE")]) != 1 || len(res[gfaKey("CYVR")]) != 1 || res[gfaKey("CYVR")][0].Region != "GFACN31" {
+		t.Fatalf("expected GFACN31 to only be kept for CYVR got %v", res)
+	}
+
+	res, err = placeGFA([]string{"CYVT"}, []scrape.GFA{{}})
+	if err != nil || len(res[gfaKey("CYVT")]) != 1 {
+		t.Fatalf("expected the only site requested to get the GFA got %v %v", res, err)
+	}
+}
@@ -1,58 +1,257 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"maps"
 	"net/http"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/metar"
 	"scuffed-v2/internal/scrape"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // TODO: all metars in one place
 // func HandleGetMetar()
 
-var registry = []scrape.RequestCoordinator{
-	{
-		SupportedSites:   scrape.Navcansites,
-		BatchFunc:        scrape.GetNavCanWeatherReports,
-		SupportsBatching: true,
-	},
-	{
-		SupportedSites:   slices.Collect(maps.Keys(scrape.SiteNamesMap)),
-		PullFunc:         scrape.GetHighwaysWeatherReport,
-		SupportsBatching: false,
-	},
-}
+// upstreamTimeout is the longest a request for every site in a source can take
+const upstreamTimeout = 20 * time.Second
+
+var store = cache.New(cache.DefaultPolicies)
 
-// GetMetar
+// GetMetar returns the weather reports for ?sites= (identifiers or presets), optionally filtered by ?category=.
+// ?notams=true includes the NOTAMs active now in each report
 func GetMetar(w http.ResponseWriter, req *http.Request) {
-	// all metar data is cronned?
-	// i think? might as well just cron it though
-	// how do i want to handle caching different data from dfiferent
-	// services and keeping it al in sync and lettin gusers specify endponits that also mihgt not exist?
-	out, _ := scrape.DoTheThing(registry, []string{"CYXE", "CYYL", "CJY4"})
-	for _, rec := range out {
-		fmt.Println(rec)
+	sites, err := parseSites(req.URL.Query().Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(out)
-}
 
-func GetGFA(w http.ResponseWriter, req *http.Request) {
-	data, err := scrape.GetGFAImageIds()
+	categories, err := parseCategories(req.URL.Query().Get("category"))
 	if err != nil {
-		w.Write([]byte(err.Error()))
+		writeError(w, http.StatusBadRequest, err)
 		return
 	}
-	json.NewEncoder(w).Encode(data)
+
+	includeNotams := false
+	if param := req.URL.Query().Get("notams"); param != "" {
+		includeNotams, err = strconv.ParseBool(param)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("notams must be true or false, got %q", param))
+			return
+		}
+	}
+
+	out, errs := weatherReports(sites)
+
+	if includeNotams {
+		var notamErrs scrape.SiteErrors
+		out, notamErrs = withNotams(out)
+		errs = append(errs, notamErrs...)
+	}
+
+	if len(categories) > 0 {
+		out = slices.DeleteFunc(out, func(report *scrape.WeatherReport) bool {
+			return !slices.Contains(categories, report.FlightCategory)
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MetarResponse{Reports: out, Errors: errs})
 }
 
-func GetWinds(w http.ResponseWriter, req *http.Request) {
-	data, err := scrape.GetWinds("CYXE")
-	if err != nil {
-		w.Write([]byte(err.Error()))
-		return
+// MetarResponse holds every report that could be pulled along with why any other sites couldn't be
+type MetarResponse struct {
+	Reports []*scrape.WeatherReport `json:"reports"`
+	Errors  scrape.SiteErrors       `json:"errors"`
+}
+
+// parseCategories parses a comma separated list of flight categories e.g. "IFR,LIFR"
+func parseCategories(param string) ([]metar.FlightCategory, error) {
+	var res []metar.FlightCategory
+	if param == "" {
+		return res, nil
+	}
+
+	for _, raw := range strings.Split(param, ",") {
+		category := metar.FlightCategory(strings.ToUpper(strings.TrimSpace(raw)))
+		if category != metar.Unknown && !slices.Contains(metar.FlightCategories, category) {
+			return nil, fmt.Errorf("unknown flight category %q", raw)
+		}
+		res = append(res, category)
+	}
+
+	return res, nil
+}
+
+// weatherReports serves the reports for sites from the cache, only sites that are missing are pulled upstream
+func weatherReports(sites []string) ([]*scrape.WeatherReport, scrape.SiteErrors) {
+	sources := scrape.Sources()
+	found := make(map[string]map[string]*scrape.WeatherReport) // by source then site
+	var errs scrape.SiteErrors
+
+	for _, site := range sites {
+		if !slices.ContainsFunc(sources, func(source scrape.Source) bool { return slices.Contains(source.SupportedSites(), site) }) {
+			errs = append(errs, &scrape.SiteError{Site: site, Kind: scrape.ErrUnsupported, Message: "no source supports this site"})
+		}
+	}
+
+	for _, source := range sources {
+		var supported []string
+		for _, site := range sites {
+			if slices.Contains(source.SupportedSites(), site) {
+				supported = append(supported, site)
+			}
+		}
+		if len(supported) == 0 {
+			continue
+		}
+
+		key := func(site string) cache.Key { return metarKey(source.Name(), site) }
+		reports, sourceErrs := fetchBySite(source.Name(), supported, key, func(ctx context.Context, sites []string) (map[cache.Key]*scrape.WeatherReport, error) {
+			return pullReports(ctx, source, sites)
+		})
+		found[source.Name()] = reports
+		errs = append(errs, sourceErrs...)
+	}
+
+	order := make([]string, 0, len(sources))
+	for _, source := range sources {
+		order = append(order, source.Name())
+	}
+
+	// keep the order sites were requested in, combining sites served by more than one source
+	var res []*scrape.WeatherReport
+	for _, site := range sites {
+		var reports []*scrape.WeatherReport
+		for _, source := range sources {
+			if report, ok := found[source.Name()][site]; ok {
+				reports = append(reports, report)
+			}
+		}
+		if len(reports) > 0 {
+			res = append(res, scrape.MergeReports(site, reports, order))
+		}
+	}
+
+	return res, errs
+}
+
+// pullReports requests sites from a single source upstream
+func pullReports(ctx context.Context, source scrape.Source, sites []string) (map[cache.Key]*scrape.WeatherReport, error) {
+	out, err := scrape.DoTheThing(ctx, []scrape.Source{source}, sites)
+
+	res := make(map[cache.Key]*scrape.WeatherReport)
+	for _, report := range out {
+		res[metarKey(source.Name(), report.Airport)] = report
+		recordHistory(source.Name(), report)
+	}
+	return res, err
+}
+
+func metarKey(source, site string) cache.Key {
+	return cache.Key{Source: source, Site: site, Product: cache.Metar}
+}
+
+// detached calls fetch with its own timeout rather than the request's context, other requests can be waiting on the
+// same cache fetch
+func detached[V any](fetch func(context.Context) (V, error)) func() (V, error) {
+	return func() (V, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+		defer cancel()
+		return fetch(ctx)
+	}
+}
+
+// fetchCached serves keys from the cache, only keys that are missing are pulled upstream and with their own timeout
+func fetchCached[V any](keys []cache.Key, pull func(ctx context.Context, missing []cache.Key) (map[cache.Key]V, error)) (map[cache.Key]V, error) {
+	return cache.FetchMany(store, keys, func(missing []cache.Key) (map[cache.Key]V, error) {
+		return detached(func(ctx context.Context) (map[cache.Key]V, error) { return pull(ctx, missing) })()
+	})
+}
+
+// fetchBySite serves the value at key(site) for each of sites from the cache by site, only sites that are missing are
+// pulled upstream. Any SiteErrors pull returns for a site are kept even if it has a value, e.g. for the parts that
+// couldn't be decoded. Sites that still don't have a value get one from source built from pull's other errors
+func fetchBySite[V any](source string, sites []string, key func(site string) cache.Key, pull func(ctx context.Context, sites []string) (map[cache.Key]V, error)) (map[string]V, scrape.SiteErrors) {
+	keys := make([]cache.Key, 0, len(sites))
+	for _, site := range sites {
+		keys = append(keys, key(site))
 	}
-	json.NewEncoder(w).Encode(data)
+
+	found, err := fetchCached(keys, func(ctx context.Context, missing []cache.Key) (map[cache.Key]V, error) {
+		missingSites := make([]string, 0, len(missing))
+		for _, key := range missing {
+			missingSites = append(missingSites, key.Site)
+		}
+		return pull(ctx, missingSites)
+	})
+
+	res := make(map[string]V)
+	var errs scrape.SiteErrors
+	siteErrs, other := splitErrors(err)
+	for _, key := range keys {
+		n := len(errs)
+		for _, siteErr := range siteErrs {
+			if siteErr.Site == key.Site {
+				errs = append(errs, siteErr)
+			}
+		}
+
+		if value, ok := found[key]; ok {
+			res[key.Site] = value
+		} else if len(errs) == n && other != nil {
+			errs = append(errs, scrape.NewSiteError(key.Site, source, other))
+		}
+	}
+	return res, errs
+}
+
+// splitErrors separates the SiteErrors in err, which can be several fetches' errors joined together, from the rest
+func splitErrors(err error) (scrape.SiteErrors, error) {
+	switch err := err.(type) {
+	case nil:
+		return nil, nil
+	case scrape.SiteErrors:
+		return err, nil
+	case interface{ Unwrap() []error }:
+		var siteErrs scrape.SiteErrors
+		var others []error
+		for _, err := range err.Unwrap() {
+			s, other := splitErrors(err)
+			siteErrs = append(siteErrs, s...)
+			if other != nil {
+				others = append(others, other)
+			}
+		}
+		return siteErrs, errors.Join(others...)
+	}
+
+	var siteErrs scrape.SiteErrors
+	if errors.As(err, &siteErrs) {
+		return siteErrs, nil
+	}
+	return nil, err
+}
+
+// GetSources lists every registered source with the sites and products it provides
+func GetSources(w http.ResponseWriter, req *http.Request) {
+	type sourceInfo struct {
+		Name         string              `json:"name"`
+		Sites        []string            `json:"sites"`
+		Capabilities []scrape.Capability `json:"capabilities"`
+	}
+
+	var res []sourceInfo
+	for _, source := range scrape.Sources() {
+		res = append(res, sourceInfo{source.Name(), source.SupportedSites(), source.Capabilities()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
 }
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"scuffed-v2/internal/history"
+	"scuffed-v2/internal/scrape"
+	"strings"
+	"time"
+)
+
+// defaultHistoryWindow is how far back /history looks when from isn't given
+const defaultHistoryWindow = 24 * time.Hour
+
+// observations is nil until OpenHistory is called, history isn't kept without it
+var observations *history.Store
+
+// OpenHistory starts recording every observation pulled into the store in dir
+func OpenHistory(dir string) error {
+	store, err := history.Open(dir)
+	if err != nil {
+		return err
+	}
+	observations = store
+	return nil
+}
+
+// recordHistory stores the observations in report, failing to store them doesn't stop the report being served
+func recordHistory(source string, report *scrape.WeatherReport) {
+	if observations == nil || len(report.Observations) == 0 {
+		return
+	}
+
+	_, err := observations.Add(source, report.Observations...)
+	if err != nil {
+		slog.Error("Unable to record history", slog.String("airport", report.Airport), slog.String("err", err.Error()))
+	}
+}
+
+// GetHistory returns every observation stored for ?site= issued between ?from= and ?to= (RFC 3339),
+// the last 24 hours by default
+func GetHistory(w http.ResponseWriter, req *http.Request) {
+	if observations == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("history is not being recorded"))
+		return
+	}
+
+	site := strings.ToUpper(strings.TrimSpace(req.URL.Query().Get("site")))
+	if site == "" {
+		writeError(w, http.StatusBadRequest, errors.New("site is required"))
+		return
+	}
+
+	to, err := parseTime(req.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseTime(req.URL.Query().Get("from"), to.Add(-defaultHistoryWindow))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("from %s is after to %s", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+		return
+	}
+
+	records, err := observations.Query(site, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Site         string           `json:"site"`
+		From         time.Time        `json:"from"`
+		To           time.Time        `json:"to"`
+		Observations []history.Record `json:"observations"`
+	}{site, from.UTC(), to.UTC(), records})
+}
+
+// parseTime parses an RFC 3339 query parameter, returning fallback if it is empty
+func parseTime(param string, fallback time.Time) (time.Time, error) {
+	if param == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.RFC3339, param)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 e.g. 2025-06-25T14:00:00Z", param)
+	}
+	return t, nil
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"strings"
+	"time"
+)
+
+func notamKey(site string) cache.Key {
+	return cache.Key{Source: scrape.NavCanadaSource, Site: site, Product: cache.Notams}
+}
+
+// SiteNotams are the NOTAMs for a single aerodrome
+type SiteNotams struct {
+	Site   string         `json:"site"`
+	Notams []scrape.Notam `json:"notams"`
+}
+
+// NotamResponse holds the NOTAMs active at a time for each requested site, along with why any sites don't have them
+type NotamResponse struct {
+	At     time.Time         `json:"at"`
+	Sites  []SiteNotams      `json:"sites"`
+	Errors scrape.SiteErrors `json:"errors"`
+}
+
+// GetNotams returns the NOTAMs for ?sites= active at ?at= (RFC 3339, now by default), only those in ?category= (e.g.
+// runway,navaid,obstacle) if given
+func GetNotams(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	sites, err := parseSites(query.Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	categories, err := parseNotamCategories(query.Get("category"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	at, err := parseTime(query.Get("at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	found, errs := notams(sites)
+	res := NotamResponse{At: at.UTC(), Sites: []SiteNotams{}, Errors: errs}
+	for _, site := range sites {
+		all, ok := found[site]
+		if !ok {
+			continue
+		}
+		res.Sites = append(res.Sites, SiteNotams{Site: site, Notams: activeNotams(all, at, categories)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseNotamCategories parses a comma separated list of NOTAM categories, none means every category
+func parseNotamCategories(param string) ([]scrape.NotamCategory, error) {
+	var res []scrape.NotamCategory
+	if strings.TrimSpace(param) == "" {
+		return res, nil
+	}
+
+	for _, raw := range strings.Split(param, ",") {
+		category := scrape.NotamCategory(strings.ToLower(strings.TrimSpace(raw)))
+		if !slices.Contains(scrape.NotamCategories, category) {
+			return nil, fmt.Errorf("unknown NOTAM category %q", raw)
+		}
+		res = append(res, category)
+	}
+
+	return res, nil
+}
+
+// activeNotams are those in all active at a time and in categories, every category if there are none
+func activeNotams(all []scrape.Notam, at time.Time, categories []scrape.NotamCategory) []scrape.Notam {
+	res := []scrape.Notam{}
+	for _, notam := range all {
+		if notam.ActiveAt(at) && (len(categories) == 0 || slices.Contains(categories, notam.Category)) {
+			res = append(res, notam)
+		}
+	}
+	return res
+}
+
+// notams serves the NOTAMs for each of sites from the cache, by site
+func notams(sites []string) (map[string][]scrape.Notam, scrape.SiteErrors) {
+	return fetchBySite(scrape.NavCanadaSource, sites, notamKey, pullNotams)
+}
+
+// pullNotams requests the NOTAMs for sites upstream, every site is given a value even if it has no NOTAMs. Those that
+// couldn't be decoded are returned as SiteErrors by location
+func pullNotams(ctx context.Context, sites []string) (map[cache.Key][]scrape.Notam, error) {
+	out, err := scrape.GetNotams(ctx, sites...)
+	if out == nil && err != nil {
+		return nil, err
+	}
+
+	res := make(map[cache.Key][]scrape.Notam)
+	for _, site := range sites {
+		res[notamKey(site)] = []scrape.Notam{}
+	}
+	for _, notam := range out {
+		for _, site := range notam.Locations {
+			if key := notamKey(site); slices.Contains(sites, site) {
+				res[key] = append(res[key], notam)
+			}
+		}
+	}
+	return res, err
+}
+
+// withNotams returns a copy of each report with the NOTAMs active now filled in
+func withNotams(reports []*scrape.WeatherReport) ([]*scrape.WeatherReport, scrape.SiteErrors) {
+	sites := make([]string, 0, len(reports))
+	for _, report := range reports {
+		sites = append(sites, report.Airport)
+	}
+	found, errs := notams(sites)
+
+	now := time.Now()
+	res := make([]*scrape.WeatherReport, 0, len(reports))
+	for _, report := range reports {
+		withNotams := *report
+		withNotams.Notams = activeNotams(found[report.Airport], now, nil)
+		res = append(res, &withNotams)
+	}
+	return res, errs
+}
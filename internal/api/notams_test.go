@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/scrape"
+	"testing"
+	"time"
+)
+
+func TestGetNotams(t *testing.T) {
+	start := time.Date(2025, 6, 18, 12, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	store.Set(notamKey("CJY4"), []scrape.Notam{
+		{Id: "A0001/25", Locations: []string{"CJY4"}, Category: scrape.NotamRunway, StartValidity: start, EndValidity: &end},
+		{Id: "A0002/25", Locations: []string{"CJY4"}, Category: scrape.NotamLighting, StartValidity: start},
+		{Id: "A0003/25", Locations: []string{"CJY4"}, Category: scrape.NotamObstacle, StartValidity: end},
+	})
+	store.Set(notamKey("CZPO"), []scrape.Notam{})
+
+	get := func(query string) NotamResponse { return getJSON[NotamResponse](t, GetNotams, "/notam?"+query) }
+
+	res := get("sites=CJY4,CZPO&at=2025-06-19T00:00:00Z")
+	if len(res.Sites) != 2 || len(res.Sites[0].Notams) != 2 || len(res.Sites[1].Notams) != 0 {
+		t.Fatalf("expected the runway and lighting NOTAMs for CJY4 and none for CZPO got %+v", res.Sites)
+	}
+
+	res = get("sites=CJY4&at=2025-06-21T00:00:00Z&category=obstacle,runway")
+	if len(res.Sites[0].Notams) != 1 || res.Sites[0].Notams[0].Id != "A0003/25" {
+		t.Fatalf("expected only the obstacle once the runway reopens got %+v", res.Sites[0].Notams)
+	}
+
+	recorder := httptest.NewRecorder()
+	GetNotams(recorder, httptest.NewRequest(http.MethodGet, "/notam?sites=CJY4&category=weather", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown category to be rejected got %d", recorder.Code)
+	}
+}
+
+func TestWithNotams(t *testing.T) {
+	store.Set(notamKey("CZPO"), []scrape.Notam{
+		{Id: "A0004/25", Locations: []string{"CZPO"}, StartValidity: time.Now().Add(-time.Hour)},
+		{Id: "A0005/25", Locations: []string{"CZPO"}, StartValidity: time.Now().Add(time.Hour)},
+	})
+
+	report := &scrape.WeatherReport{Airport: "CZPO"}
+	res, errs := withNotams([]*scrape.WeatherReport{report})
+	if len(errs) != 0 || len(res[0].Notams) != 1 || res[0].Notams[0].Id != "A0004/25" {
+		t.Fatalf("expected only the active NOTAM got %+v %v", res[0].Notams, errs)
+	}
+	if report.Notams != nil {
+		t.Fatal("expected the original report to be left as is")
+	}
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// pirepFetchRadius is how far from each site PIREPs are pulled, requests can ask for any radius up to it
+	pirepFetchRadius   = 200 // nm
+	defaultPirepRadius = 50  // nm
+	defaultPirepWindow = 2 * time.Hour
+)
+
+func pirepKey(site string) cache.Key {
+	return cache.Key{Source: scrape.NavCanadaSource, Site: site, Product: cache.Pireps}
+}
+
+// NearbyPirep is a PIREP along with how far it was from the site, Distance is nil if its position isn't known
+type NearbyPirep struct {
+	scrape.Pirep
+	Distance *float64 `json:"distance"` // nm
+}
+
+type SitePireps struct {
+	Site   string        `json:"site"`
+	Pireps []NearbyPirep `json:"pireps"`
+}
+
+// PirepResponse holds the PIREPs near each requested site, along with why any sites don't have them
+type PirepResponse struct {
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Radius int               `json:"radius"` // nm
+	Sites  []SitePireps      `json:"sites"`
+	Errors scrape.SiteErrors `json:"errors"`
+}
+
+// GetPireps returns the PIREPs within ?radius= nm (50 by default) of each of ?sites= made between ?from= and ?to=
+// (RFC 3339, the last 2 hours by default), newest first. PIREPs whose position couldn't be decoded are included when
+// NavCanada returned them for the site
+func GetPireps(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	sites, err := parseSites(query.Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	radius := defaultPirepRadius
+	if param := query.Get("radius"); param != "" {
+		radius, err = strconv.Atoi(param)
+		if err != nil || radius <= 0 || radius > pirepFetchRadius {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("radius must be between 1 and %d nm, got %q", pirepFetchRadius, param))
+			return
+		}
+	}
+
+	now := time.Now()
+	to, err := parseTime(query.Get("to"), now)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := parseTime(query.Get("from"), to.Add(-defaultPirepWindow))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	found, errs := pireps(sites)
+	res := PirepResponse{From: from.UTC(), To: to.UTC(), Radius: radius, Sites: []SitePireps{}, Errors: errs}
+	for _, site := range sites {
+		all, ok := found[site]
+		if !ok {
+			continue
+		}
+		res.Sites = append(res.Sites, SitePireps{Site: site, Pireps: nearbyPireps(site, all, float64(radius), from, to)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// nearbyPireps are those in all within radius nm of site made between from and to
+func nearbyPireps(site string, all []scrape.Pirep, radius float64, from, to time.Time) []NearbyPirep {
+	position, known := geo.Lookup(site)
+
+	res := []NearbyPirep{}
+	for _, pirep := range all {
+		if pirep.Time.Before(from) || pirep.Time.After(to) {
+			continue
+		}
+
+		nearby := NearbyPirep{Pirep: pirep}
+		if known && pirep.Position != nil {
+			distance := math.Round(geo.Distance(position, *pirep.Position)*10) / 10
+			if distance > radius {
+				continue
+			}
+			nearby.Distance = &distance
+		}
+		res = append(res, nearby)
+	}
+	return res
+}
+
+// pireps serves the PIREPs near each of sites from the cache, by site
+func pireps(sites []string) (map[string][]scrape.Pirep, scrape.SiteErrors) {
+	return fetchBySite(scrape.NavCanadaSource, sites, pirepKey, pullPireps)
+}
+
+// pullPireps requests the PIREPs within pirepFetchRadius of sites upstream, every site is given a value even if there
+// are none near it. Those that couldn't be decoded are returned as SiteErrors for the sites they're near
+func pullPireps(ctx context.Context, sites []string) (map[cache.Key][]scrape.Pirep, error) {
+	out, err := scrape.GetPireps(ctx, pirepFetchRadius, sites...)
+	if out == nil && err != nil {
+		return nil, err
+	}
+
+	res := make(map[cache.Key][]scrape.Pirep)
+	for _, site := range sites {
+		res[pirepKey(site)] = []scrape.Pirep{}
+	}
+	for _, pirep := range out {
+		for _, site := range sites {
+			position, known := geo.Lookup(site)
+			near := slices.Contains(pirep.Sites, site)
+			if known && pirep.Position != nil {
+				near = geo.Distance(position, *pirep.Position) <= pirepFetchRadius
+			}
+			if near {
+				res[pirepKey(site)] = append(res[pirepKey(site)], pirep)
+			}
+		}
+	}
+	return res, err
+}
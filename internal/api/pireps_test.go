@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"testing"
+	"time"
+)
+
+func TestGetPireps(t *testing.T) {
+	now := time.Date(2025, 6, 18, 19, 0, 0, 0, time.UTC)
+	at := func(site string, bearing, distance float64) *geo.Point {
+		p := geo.Destination(geo.Stations[site], bearing, distance)
+		return &p
+	}
+	store.Set(pirepKey("CYXE"), []scrape.Pirep{
+		{AircraftType: "C172", Time: now.Add(-30 * time.Minute), Position: at("CYXE", 90, 10)},
+		{AircraftType: "PC12", Time: now.Add(-time.Hour), Position: at("CYXE", 180, 80)},
+		{AircraftType: "DH8D", Time: now.Add(-3 * time.Hour), Position: at("CYXE", 0, 5)},
+		{AircraftType: "B737", Time: now.Add(-90 * time.Minute), Sites: []string{"CYXE"}},
+	})
+
+	get := func(query string) PirepResponse { return getJSON[PirepResponse](t, GetPireps, "/pirep?"+query) }
+	types := func(res PirepResponse) []string {
+		var types []string
+		for _, pirep := range res.Sites[0].Pireps {
+			types = append(types, pirep.AircraftType)
+		}
+		return types
+	}
+
+	res := get("sites=CYXE&to=2025-06-18T19:00:00Z")
+	if actual := types(res); len(actual) != 2 || actual[0] != "C172" || actual[1] != "B737" {
+		t.Fatalf("expected the C172 within 50nm and the B737 without a position got %v", actual)
+	}
+	if distance := res.Sites[0].Pireps[0].Distance; distance == nil || *distance != 10 {
+		t.Fatalf("expected the C172 10nm away got %v", distance)
+	}
+	if res.Sites[0].Pireps[1].Distance != nil {
+		t.Fatal("expected no distance without a position")
+	}
+
+	res = get("sites=CYXE&radius=100&from=2025-06-18T15:00:00Z&to=2025-06-18T19:00:00Z")
+	if actual := types(res); len(actual) != 4 {
+		t.Fatalf("expected every report within 100nm in the last 4 hours got %v", actual)
+	}
+
+	for _, query := range []string{"sites=CYXE&radius=0", "sites=CYXE&radius=500", "sites=CYXE&from=yesterday"} {
+		recorder := httptest.NewRecorder()
+		GetPireps(recorder, httptest.NewRequest(http.MethodGet, "/pirep?"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 got %d", query, recorder.Code)
+		}
+	}
+}
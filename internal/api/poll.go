@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"scuffed-v2/internal/poller"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"time"
+)
+
+// pollIntervals is how often each source has all of its sites pulled, sources not listed use defaultPollInterval
+var pollIntervals = map[string]time.Duration{
+	scrape.NavCanadaSource: 3 * time.Minute,
+}
+
+const defaultPollInterval = 4 * time.Minute
+
+var scheduler = poller.New()
+
+// StartPolling keeps the cache warm for every registered site so requests don't wait on upstream sources
+func StartPolling(ctx context.Context) {
+	for _, source := range scrape.Sources() {
+		interval, ok := pollIntervals[source.Name()]
+		if !ok {
+			interval = defaultPollInterval
+		}
+
+		scheduler.Add(poller.Job{
+			Name:     source.Name() + "/metar",
+			Interval: interval,
+			Jitter:   30 * time.Second,
+			Run: func(ctx context.Context) error {
+				ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+				defer cancel()
+
+				reports, err := pullReports(ctx, source, source.SupportedSites())
+				for key, report := range reports {
+					store.Set(key, report)
+				}
+				events := announceReports(slices.Collect(maps.Values(reports)))
+				evaluateAlerts(ctx, events)
+				return err
+			},
+		})
+	}
+
+	scheduler.Add(poller.Job{
+		Name:     scrape.NavCanadaSource + "/gfa",
+		Interval: time.Hour,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+
+			gfas, err := pullGFA(ctx, slices.Collect(maps.Values(scrape.GFARegions)))
+			var all []scrape.GFA
+			for key, value := range gfas {
+				store.Set(key, value)
+				all = append(all, value...)
+			}
+			announceGFA(all)
+			return err
+		},
+	})
+
+	scheduler.Add(poller.Job{
+		Name:     scrape.NavCanadaSource + "/advisories",
+		Interval: 5 * time.Minute,
+		Jitter:   30 * time.Second,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+
+			advisories, err := pullAdvisories(ctx)
+			for key, value := range advisories {
+				store.Set(key, value)
+			}
+			return err
+		},
+	})
+
+	scheduler.Add(poller.Job{
+		Name:     scrape.NavCanadaSource + "/notams",
+		Interval: 10 * time.Minute,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+
+			notams, err := pullNotams(ctx, supportedSites())
+			for key, value := range notams {
+				store.Set(key, value)
+			}
+			return err
+		},
+	})
+
+	scheduler.Add(poller.Job{
+		Name:     scrape.NavCanadaSource + "/pireps",
+		Interval: 5 * time.Minute,
+		Jitter:   30 * time.Second,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+
+			pireps, err := pullPireps(ctx, supportedSites())
+			for key, value := range pireps {
+				store.Set(key, value)
+			}
+			return err
+		},
+	})
+
+	// upper winds are issued four times a day, Interval is only used when retrying
+	scheduler.Add(poller.Job{
+		Name:     scrape.NavCanadaSource + "/upperwinds",
+		Interval: 10 * time.Minute,
+		Next:     poller.AtHours(15, 2, 8, 14, 20),
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, upstreamTimeout)
+			defer cancel()
+
+			winds, err := pullWinds(ctx, scrape.UpperWindStations)
+			for key, value := range winds {
+				store.Set(key, value)
+			}
+			return err
+		},
+	})
+
+	if gfaImages != nil {
+		scheduler.Add(poller.Job{
+			Name:     "gfa/images/prune",
+			Interval: 6 * time.Hour,
+			Run: func(ctx context.Context) error {
+				return gfaImages.Prune(gfaImageRetention)
+			},
+		})
+	}
+
+	scheduler.Start(ctx)
+}
+
+// GetJobs lists when each polling job last ran and will next run
+func GetJobs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scheduler.Status())
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"strings"
+)
+
+// defaultSites are used when a request doesn't ask for any
+var defaultSites = []string{"CYXE", "CYYL", "CJY4"}
+
+// allPreset expands to every site supported by a registered source
+const allPreset = "all"
+
+// presets are named groups of sites that can be used in place of listing every identifier
+var presets = map[string][]string{
+	"north": {"CYSF", "CYBE", "CZFD", "CZWL", "CYKJ", "CYPY", "CYSM", "CJW7", "CKQ8", "CYNL"},
+	"west":  {"CYVT", "CJL4", "CKB2", "CJF3", "CYLJ", "CYMM", "CYOD", "CYLL", "CYQW", "CET2"},
+	"east":  {"CYVC", "CZPO", "CJY4", "CJW4", "CJT4", "CYHB", "CYFO", "CYQD", "CYTH", "CYYL"},
+	"south": {"CYXE", "CYPA", "CYQR", "CYYN", "CYXH", "CYQV"},
+}
+
+// UnknownSitesError is returned when a request asks for sites no source supports
+type UnknownSitesError struct {
+	Sites []string `json:"unknown_sites"`
+}
+
+func (e *UnknownSitesError) Error() string {
+	return fmt.Sprintf("unknown sites: %s", strings.Join(e.Sites, ", "))
+}
+
+// supportedSites is every site any registered source can pull
+func supportedSites() []string {
+	var res []string
+	for _, source := range scrape.Sources() {
+		for _, site := range source.SupportedSites() {
+			if !slices.Contains(res, site) {
+				res = append(res, site)
+			}
+		}
+	}
+	slices.Sort(res)
+	return res
+}
+
+// parseSites parses a comma separated list of site identifiers and preset names e.g. "north,CYXE", returning an
+// UnknownSitesError listing every identifier that isn't supported
+func parseSites(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return defaultSites, nil
+	}
+
+	supported := supportedSites()
+	var res, unknown []string
+	add := func(site string) {
+		if !slices.Contains(res, site) {
+			res = append(res, site)
+		}
+	}
+
+	for _, raw := range strings.Split(param, ",") {
+		site := strings.ToUpper(strings.TrimSpace(raw))
+		preset := strings.ToLower(site)
+
+		switch {
+		case site == "":
+			continue
+		case preset == allPreset:
+			for _, s := range supported {
+				add(s)
+			}
+		case presets[preset] != nil:
+			for _, s := range presets[preset] {
+				add(s)
+			}
+		case slices.Contains(supported, site):
+			add(site)
+		default:
+			unknown = append(unknown, site)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, &UnknownSitesError{Sites: unknown}
+	}
+	return res, nil
+}
+
+// GetSites lists every supported site and the presets that can be used in place of them
+func GetSites(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Sites   []string            `json:"sites"`
+		Presets map[string][]string `json:"presets"`
+	}{supportedSites(), presets})
+}
+
+// writeError responds with status and err as JSON
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	var unknownSites *UnknownSitesError
+	if errors.As(err, &unknownSites) {
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			*UnknownSitesError
+		}{err.Error(), unknownSites})
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseSites(t *testing.T) {
+	cases := []struct {
+		param    string
+		expected []string
+	}{
+		{"", defaultSites},
+		{"cyxe, CJY4", []string{"CYXE", "CJY4"}},
+		{"CYXE,CYXE", []string{"CYXE"}},
+		{"north", presets["north"]},
+		{"CYXE,south", append([]string{"CYXE"}, presets["south"][1:]...)},
+	}
+
+	for _, tc := range cases {
+		actual, err := parseSites(tc.param)
+		if err != nil {
+			t.Fatalf("%q: %s", tc.param, err)
+		}
+		if !slices.Equal(actual, tc.expected) {
+			t.Fatalf("%q: expected %v got %v", tc.param, tc.expected, actual)
+		}
+	}
+
+	all, err := parseSites("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(all, supportedSites()) {
+		t.Fatalf("expected every supported site got %v", all)
+	}
+}
+
+func TestParseSitesUnknown(t *testing.T) {
+	_, err := parseSites("CYXE,KXXX,nowhere")
+
+	var unknown *UnknownSitesError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected UnknownSitesError got %v", err)
+	}
+	if expected := []string{"KXXX", "NOWHERE"}; !slices.Equal(unknown.Sites, expected) {
+		t.Fatalf("expected %v got %v", expected, unknown.Sites)
+	}
+}
+
+func TestPresetsAreSupported(t *testing.T) {
+	supported := supportedSites()
+	for name, sites := range presets {
+		for _, site := range sites {
+			if !slices.Contains(supported, site) {
+				t.Fatalf("preset %q has unsupported site %s", name, site)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/scrape"
+	"scuffed-v2/internal/stream"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies
+const heartbeatInterval = 30 * time.Second
+
+var broker = stream.NewBroker()
+
+// latest is the newest product seen for each site, the first poll of a site only records what is there so clients
+// aren't sent every product on startup
+var latest = struct {
+	sync.Mutex
+	observations map[string]time.Time
+	forecasts    map[string]time.Time
+	gfa          map[string][]string // image ids by region
+}{
+	observations: make(map[string]time.Time),
+	forecasts:    make(map[string]time.Time),
+	gfa:          make(map[string][]string),
+}
+
+// announceReports publishes any observations and TAFs in reports that are newer than the last poll, returning what
+// was published. Reports for the same site from different sources are only announced once
+func announceReports(reports []*scrape.WeatherReport) []stream.Event {
+	latest.Lock()
+	defer latest.Unlock()
+
+	var events []stream.Event
+	for _, report := range reports {
+		site := report.Airport
+
+		last, seen := latest.observations[site]
+		for _, obs := range sortedByTime(report.Observations, func(obs metar.Observation) time.Time { return obs.Time }) {
+			if !obs.Time.After(last) {
+				continue
+			}
+			if seen {
+				kind := stream.Metar
+				if obs.Type == metar.Speci {
+					kind = stream.Speci
+				}
+				events = append(events, stream.Event{Kind: kind, Site: site, Time: obs.Time, Data: obs})
+			}
+			last = obs.Time
+		}
+		latest.observations[site] = last
+
+		last, seen = latest.forecasts[site]
+		for _, taf := range sortedByTime(report.Forecasts, func(taf metar.TAF) time.Time { return taf.Issued }) {
+			if !taf.Issued.After(last) {
+				continue
+			}
+			if seen {
+				kind := stream.Taf
+				if taf.Amended {
+					kind = stream.TafAmendment
+				}
+				events = append(events, stream.Event{Kind: kind, Site: site, Time: taf.Issued, Data: taf})
+			}
+			last = taf.Issued
+		}
+		latest.forecasts[site] = last
+	}
+
+	broker.Publish(events...)
+	return events
+}
+
+// announceGFA publishes each region in gfas whose frames have changed since the last poll
+func announceGFA(gfas []scrape.GFA) {
+	latest.Lock()
+	defer latest.Unlock()
+
+	var events []stream.Event
+	for _, gfa := range gfas {
+		var ids []string
+		for _, frame := range slices.Concat(gfa.CloudsWeather, gfa.IcingTurbulenceFreezing) {
+			ids = append(ids, frame.Id)
+		}
+
+		previous, seen := latest.gfa[gfa.Region]
+		latest.gfa[gfa.Region] = ids
+		if seen && !slices.Equal(previous, ids) {
+			events = append(events, stream.Event{Kind: stream.GFA, Site: gfa.Region, Time: time.Now().UTC(), Data: withImageURLs(gfa)})
+		}
+	}
+
+	broker.Publish(events...)
+}
+
+func sortedByTime[T any](items []T, issued func(T) time.Time) []T {
+	return slices.SortedFunc(slices.Values(items), func(a, b T) int { return issued(a).Compare(issued(b)) })
+}
+
+// GetStream sends an event (SSE) whenever the poller sees a new METAR, SPECI, TAF or GFA for ?sites=, every site
+// when it isn't given
+func GetStream(w http.ResponseWriter, req *http.Request) {
+	sites, err := streamSites(req.URL.Query().Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+
+	events, cancel := broker.Subscribe(sites)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				// fell too far behind, the client will reconnect
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// streamSites parses the sites to subscribe to along with the GFA regions covering them, as GFAs are announced by
+// region. nil is every site
+func streamSites(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return nil, nil
+	}
+
+	sites, err := parseSites(param)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, _ := regionalGFA(sites)
+	for _, gfa := range regions {
+		sites = append(sites, gfa.Region)
+	}
+	return sites, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"scuffed-v2/internal/metar"
+	"scuffed-v2/internal/scrape"
+	"scuffed-v2/internal/stream"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAnnounceReports(t *testing.T) {
+	ref := time.Date(2025, 6, 25, 2, 0, 0, 0, time.UTC)
+	report := func(raws ...string) *scrape.WeatherReport {
+		res := &scrape.WeatherReport{Airport: "CYVT"}
+		for _, raw := range raws {
+			obs, err := metar.Parse(raw, ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Observations = append(res.Observations, obs)
+		}
+		return res
+	}
+
+	events, cancel := broker.Subscribe([]string{"CYVT"})
+	defer cancel()
+
+	metar0000 := "METAR CYVT 250000Z 31012KT 15SM FEW030 21/05 A2992"
+	speci0042 := "SPECI CYVT 250042Z 31012KT 3SM -SHRA BKN008 19/12 A2992"
+	metar0100 := "METAR CYVT 250100Z 31012KT 15SM FEW030 20/05 A2992"
+
+	// the first poll only records what is there
+	announceReports([]*scrape.WeatherReport{report(metar0000)})
+	if len(events) != 0 {
+		t.Fatalf("expected no events on the first poll got %d", len(events))
+	}
+
+	// the same reports from a second source aren't announced twice
+	announceReports([]*scrape.WeatherReport{report(metar0100, speci0042, metar0000), report(metar0100, speci0042)})
+
+	for _, expected := range []stream.Kind{stream.Speci, stream.Metar} {
+		select {
+		case event := <-events:
+			if event.Kind != expected || event.Site != "CYVT" {
+				t.Fatalf("expected a %s for CYVT got %s for %s", expected, event.Kind, event.Site)
+			}
+		default:
+			t.Fatalf("expected a %s event", expected)
+		}
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected 2 events got %d more", len(events))
+	}
+}
+
+func TestStreamSites(t *testing.T) {
+	store.Set(gfaKey("CYVT"), []scrape.GFA{{Region: "GFACN32"}})
+
+	sites, err := streamSites("")
+	if err != nil || sites != nil {
+		t.Fatalf("expected every site without ?sites= got %v %v", sites, err)
+	}
+
+	sites, err = streamSites("CYVT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sites, []string{"CYVT", "GFACN32"}) {
+		t.Fatalf("expected CYVT and its GFA region got %v", sites)
+	}
+}
+
+func TestAnnounceGFA(t *testing.T) {
+	events, cancel := broker.Subscribe([]string{"CYVT", "GFACN32"})
+	defer cancel()
+
+	gfa := func(region, id string) scrape.GFA {
+		return scrape.GFA{Region: region, CloudsWeather: []scrape.GFAMetadata{{Id: id}}}
+	}
+	announceGFA([]scrape.GFA{gfa("GFACN32", "1"), gfa("GFACN31", "1")})
+	announceGFA([]scrape.GFA{gfa("GFACN32", "2"), gfa("GFACN31", "2")})
+
+	select {
+	case event := <-events:
+		if event.Kind != stream.GFA || event.Site != "GFACN32" {
+			t.Fatalf("expected a GFA for GFACN32 got %s for %s", event.Kind, event.Site)
+		}
+	default:
+		t.Fatal("expected a GFA event")
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected the other region to be filtered out, %d events left", len(events))
+	}
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"scuffed-v2/internal/cache"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"scuffed-v2/internal/winds"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Band string
+
+const (
+	LowBand  Band = "low" // 18,000ft and below
+	HighBand Band = "high"
+	BothBand Band = "both"
+)
+
+// defaultWindSites is what /winds returns when no sites are given
+var defaultWindSites = []string{"CYXE"}
+
+// nearestWindStations is how many of the closest upper wind stations are pulled for an estimate, one more than are
+// blended in case a station is missing its forecast
+const nearestWindStations = 4
+
+func windsKey(station string) cache.Key {
+	return cache.Key{Source: scrape.NavCanadaSource, Site: station, Product: cache.UpperWinds}
+}
+
+// upperWinds serves the upper winds for stations from the cache, in the order they were given
+func upperWinds(stations []string) ([]scrape.AirportWinds, error) {
+	found, errs := fetchBySite(scrape.NavCanadaSource, stations, windsKey, pullWinds)
+
+	var res []scrape.AirportWinds
+	for _, station := range stations {
+		if value, ok := found[station]; ok {
+			res = append(res, value)
+		}
+	}
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
+
+// pullWinds requests the upper winds for stations upstream
+func pullWinds(ctx context.Context, stations []string) (map[cache.Key]scrape.AirportWinds, error) {
+	out, err := scrape.GetWinds(ctx, stations...)
+
+	res := make(map[cache.Key]scrape.AirportWinds)
+	for _, station := range out {
+		res[windsKey(station.AirportCode)] = station
+	}
+	return res, err
+}
+
+// SiteWinds is the upper wind forecast for use at a site, from the nearest upper wind station
+type SiteWinds struct {
+	Site     string       `json:"site"`
+	Station  string       `json:"station"`
+	Distance float64      `json:"distance"` // nm from site to Station
+	Low      *scrape.Wind `json:"low,omitempty"`
+	High     *scrape.Wind `json:"high,omitempty"`
+}
+
+// WindsResponse holds the forecasts for use at ValidAt for every site that has one, along with why any other sites
+// don't
+type WindsResponse struct {
+	ValidAt time.Time         `json:"valid_at"`
+	Band    Band              `json:"band"`
+	Winds   []SiteWinds       `json:"winds"`
+	Errors  scrape.SiteErrors `json:"errors"`
+}
+
+// GetWinds returns the upper winds for ?sites= in the ?band= (low, high or both) for use at ?valid_at= (RFC 3339,
+// now by default). Sites that aren't upper wind stations use the nearest station's forecast
+func GetWinds(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	sites, err := parseWindSites(query.Get("sites"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	band := Band(strings.ToLower(query.Get("band")))
+	switch band {
+	case "":
+		band = BothBand
+	case LowBand, HighBand, BothBand:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown band %q, expected low, high or both", query.Get("band")))
+		return
+	}
+
+	validAt, err := parseTime(query.Get("valid_at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res := WindsResponse{ValidAt: validAt.UTC(), Band: band, Winds: []SiteWinds{}}
+
+	stationFor := make(map[string]string)
+	var stations []string
+	for _, site := range sites {
+		station := nearestStations(geo.Stations[site], scrape.UpperWindStations, 1)[0]
+		stationFor[site] = station
+		if !slices.Contains(stations, station) {
+			stations = append(stations, station)
+		}
+	}
+
+	forecasts, err := upperWinds(stations)
+	for _, site := range sites {
+		station := stationFor[site]
+		i := slices.IndexFunc(forecasts, func(forecast scrape.AirportWinds) bool { return forecast.AirportCode == station })
+		if i < 0 {
+			reason := fmt.Errorf("no upper winds for %s", station)
+			if err != nil {
+				reason = err
+			}
+			res.Errors = append(res.Errors, scrape.NewSiteError(site, scrape.NavCanadaSource, reason))
+			continue
+		}
+
+		siteWinds := SiteWinds{
+			Site:     site,
+			Station:  station,
+			Distance: math.Round(geo.Distance(geo.Stations[site], geo.Stations[station])*10) / 10,
+		}
+		if low, ok := winds.ForUse(forecasts[i].Low, validAt); ok && band != HighBand {
+			siteWinds.Low = &low
+		}
+		if high, ok := winds.ForUse(forecasts[i].High, validAt); ok && band != LowBand {
+			siteWinds.High = &high
+		}
+
+		if siteWinds.Low == nil && siteWinds.High == nil {
+			res.Errors = append(res.Errors, &scrape.SiteError{
+				Site:    site,
+				Source:  scrape.NavCanadaSource,
+				Kind:    scrape.ErrNoData,
+				Message: fmt.Sprintf("no %s upper winds from %s are for use at %s", band, station, validAt.UTC().Format(time.RFC3339)),
+			})
+			continue
+		}
+		res.Winds = append(res.Winds, siteWinds)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseWindSites parses a comma separated list of sites with known positions, upper wind stations or not
+func parseWindSites(param string) ([]string, error) {
+	if strings.TrimSpace(param) == "" {
+		return defaultWindSites, nil
+	}
+
+	var res, unknown []string
+	for _, raw := range strings.Split(param, ",") {
+		site := strings.ToUpper(strings.TrimSpace(raw))
+		_, known := geo.Lookup(site)
+		switch {
+		case site == "", slices.Contains(res, site):
+		case known:
+			res = append(res, site)
+		default:
+			unknown = append(unknown, site)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, &UnknownSitesError{Sites: unknown}
+	}
+	return res, nil
+}
+
+// GetWindsAloft estimates the winds at ?alt= (feet) over ?site= or ?lat=&lon= at ?at= (RFC 3339, now by default)
+// from the nearest upper wind stations
+func GetWindsAloft(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	position, err := parsePosition(query.Get("site"), query.Get("lat"), query.Get("lon"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	altitude, err := strconv.Atoi(query.Get("alt"))
+	if err != nil || altitude < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("alt must be a positive altitude in feet, got %q", query.Get("alt")))
+		return
+	}
+
+	at, err := parseTime(query.Get("at"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	stations, err := upperWinds(nearestStations(position, scrape.UpperWindStations, nearestWindStations))
+	estimate, estimateErr := winds.Interpolate(stations, position, altitude, at)
+	switch {
+	case estimateErr == nil:
+	case err != nil:
+		writeError(w, http.StatusBadGateway, err)
+		return
+	default:
+		writeError(w, http.StatusNotFound, estimateErr)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(estimate)
+}
+
+// parsePosition returns the position of site, or of lat and lon when site isn't given
+func parsePosition(site, lat, lon string) (geo.Point, error) {
+	if site != "" {
+		site = strings.ToUpper(strings.TrimSpace(site))
+		position, ok := geo.Lookup(site)
+		if !ok {
+			return geo.Point{}, &UnknownSitesError{Sites: []string{site}}
+		}
+		return position, nil
+	}
+
+	if lat == "" || lon == "" {
+		return geo.Point{}, errors.New("site or lat and lon are required")
+	}
+	latitude, latErr := strconv.ParseFloat(lat, 64)
+	longitude, lonErr := strconv.ParseFloat(lon, 64)
+	if latErr != nil || lonErr != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return geo.Point{}, fmt.Errorf("invalid position %q, %q", lat, lon)
+	}
+	return geo.Point{Lat: latitude, Lon: longitude}, nil
+}
+
+// nearestStations returns up to n of stations closest to position
+func nearestStations(position geo.Point, stations []string, n int) []string {
+	var known []string
+	for _, station := range stations {
+		if _, ok := geo.Lookup(station); ok {
+			known = append(known, station)
+		}
+	}
+
+	slices.SortFunc(known, func(a, b string) int {
+		return cmp.Compare(geo.Distance(position, geo.Stations[a]), geo.Distance(position, geo.Stations[b]))
+	})
+	return known[:min(n, len(known))]
+}
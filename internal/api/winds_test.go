@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParsePosition(t *testing.T) {
+	position, err := parsePosition("cyvt", "", "")
+	if err != nil || position != geo.Stations["CYVT"] {
+		t.Fatalf("expected the position of CYVT got %v %v", position, err)
+	}
+
+	position, err = parsePosition("", "55.8", "-108.4")
+	if err != nil || position != (geo.Point{Lat: 55.8, Lon: -108.4}) {
+		t.Fatalf("expected 55.8,-108.4 got %v %v", position, err)
+	}
+
+	var unknown *UnknownSitesError
+	if _, err := parsePosition("KXXX", "", ""); !errors.As(err, &unknown) {
+		t.Fatalf("expected UnknownSitesError got %v", err)
+	}
+	for _, latLon := range [][2]string{{"", ""}, {"95", "0"}, {"north", "west"}} {
+		if _, err := parsePosition("", latLon[0], latLon[1]); err == nil {
+			t.Fatalf("expected %v to be invalid", latLon)
+		}
+	}
+}
+
+func TestNearestStations(t *testing.T) {
+	actual := nearestStations(geo.Stations["CYVT"], []string{"CYQR", "CYXE", "KXXX", "CYMM", "CYPA"}, 3)
+	if expected := []string{"CYMM", "CYPA", "CYXE"}; !slices.Equal(actual, expected) {
+		t.Fatalf("expected %v got %v", expected, actual)
+	}
+}
+
+func TestGetWinds(t *testing.T) {
+	issued := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+	forecast := func(hours, forUseStart, forUseEnd int, elevation int) scrape.Wind {
+		return scrape.Wind{
+			Data:        []scrape.ElevationValues{{Elevation: elevation}},
+			Valid:       issued.Add(time.Duration(hours) * time.Hour),
+			ForUseStart: issued.Add(time.Duration(forUseStart) * time.Hour),
+			ForUseEnd:   issued.Add(time.Duration(forUseEnd) * time.Hour),
+		}
+	}
+	store.Set(windsKey("CYXE"), scrape.AirportWinds{
+		AirportCode: "CYXE",
+		Low:         []scrape.Wind{forecast(6, 2, 9, 3000), forecast(12, 9, 18, 6000), forecast(24, 18, 30, 9000)},
+		High:        []scrape.Wind{forecast(12, 9, 18, 24000)},
+	})
+
+	get := func(query string) WindsResponse { return getJSON[WindsResponse](t, GetWinds, "/winds?"+query) }
+
+	// North Battleford uses the forecast for Saskatoon
+	res := get("sites=CYXE,CYQW&valid_at=2025-06-25T10:00:00Z")
+	if len(res.Winds) != 2 || res.Winds[1].Station != "CYXE" {
+		t.Fatalf("expected winds for CYXE and CYQW from CYXE got %+v", res.Winds)
+	}
+	if res.Winds[0].Low.Data[0].Elevation != 6000 || res.Winds[0].High == nil {
+		t.Fatalf("expected the 12h forecast got %+v", res.Winds[0])
+	}
+
+	res = get("sites=CYXE&band=low&valid_at=2025-06-25T20:00:00Z")
+	if len(res.Winds) != 1 || res.Winds[0].Low.Data[0].Elevation != 9000 || res.Winds[0].High != nil {
+		t.Fatalf("expected only the low 24h forecast got %+v", res.Winds)
+	}
+
+	res = get("sites=CYXE&band=high&valid_at=2025-06-25T20:00:00Z")
+	if len(res.Winds) != 0 || len(res.Errors) != 1 || res.Errors[0].Kind != scrape.ErrNoData {
+		t.Fatalf("expected no high winds for use got %+v", res)
+	}
+
+	recorder := httptest.NewRecorder()
+	GetWinds(recorder, httptest.NewRequest(http.MethodGet, "/winds?band=middle", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown band to be rejected got %d", recorder.Code)
+	}
+}
@@ -1,3 +1,255 @@
+// Package cache holds scraped products between requests so upstream sources aren't hit for every request
 package cache
 
-// cache data for requests
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type Product string
+
+const (
+	Metar      Product = "metar" // METAR and TAF are pulled together
+	GFA        Product = "gfa"
+	UpperWinds Product = "upperwinds"
+	Advisories Product = "advisories" // SIGMETs and AIRMETs
+	Notams     Product = "notams"
+	Pireps     Product = "pireps"
+)
+
+// Key identifies a single cached product for a site from a source
+type Key struct {
+	Source  string
+	Site    string
+	Product Product
+}
+
+func (k Key) String() string {
+	return k.Source + "/" + k.Site + "/" + string(k.Product)
+}
+
+// Policy controls how long a product is served from the cache. Once TTL has passed the value is still served for
+// Stale while it is refreshed in the background, after that callers wait on the upstream request
+type Policy struct {
+	TTL   time.Duration
+	Stale time.Duration
+}
+
+var DefaultPolicies = map[Product]Policy{
+	Metar:      {TTL: 5 * time.Minute, Stale: 15 * time.Minute},
+	GFA:        {TTL: 90 * time.Minute, Stale: 3 * time.Hour},
+	UpperWinds: {TTL: 7 * time.Hour, Stale: 6 * time.Hour},
+	Advisories: {TTL: 5 * time.Minute, Stale: 10 * time.Minute},
+	Notams:     {TTL: 10 * time.Minute, Stale: 30 * time.Minute},
+	Pireps:     {TTL: 5 * time.Minute, Stale: 10 * time.Minute},
+}
+
+type State int
+
+const (
+	Missing State = iota
+	Fresh
+	Stale
+)
+
+// pruneInterval is how often Set drops expired entries
+const pruneInterval = 10 * time.Minute
+
+type entry struct {
+	value   any
+	fetched time.Time
+}
+
+// A flight is an upstream fetch for some keys that callers wait on instead of fetching those keys themselves
+type flight struct {
+	done   chan struct{}
+	values map[Key]any
+	err    error
+}
+
+type Cache struct {
+	mu       sync.RWMutex
+	entries  map[Key]entry
+	flights  map[Key]*flight
+	policies map[Product]Policy
+	pruned   time.Time
+	now      func() time.Time
+}
+
+func New(policies map[Product]Policy) *Cache {
+	return &Cache{
+		entries:  make(map[Key]entry),
+		flights:  make(map[Key]*flight),
+		policies: policies,
+		now:      time.Now,
+	}
+}
+
+// Get returns the value stored at key and whether it is Fresh, Stale or Missing (expired values are Missing)
+func (c *Cache) Get(key Key) (any, State) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, Missing
+	}
+
+	return e.value, c.state(key, e)
+}
+
+func (c *Cache) state(key Key, e entry) State {
+	policy := c.policies[key.Product]
+	age := c.now().Sub(e.fetched)
+	switch {
+	case age < policy.TTL:
+		return Fresh
+	case age < policy.TTL+policy.Stale:
+		return Stale
+	}
+	return Missing
+}
+
+// Set stores value at key, replacing anything already there. Expired entries are dropped every pruneInterval so keys
+// that stop being requested don't stay around forever
+func (c *Cache) Set(key Key, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.entries[key] = entry{value: value, fetched: now}
+
+	if now.Sub(c.pruned) < pruneInterval {
+		return
+	}
+	c.pruned = now
+	for key, e := range c.entries {
+		if c.state(key, e) == Missing {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Fetch returns the value at key, calling fetch to populate it if it is missing.
+// Stale values are returned immediately and refreshed in the background
+func Fetch[V any](c *Cache, key Key, fetch func() (V, error)) (V, error) {
+	res, err := FetchMany(c, []Key{key}, func(keys []Key) (map[Key]V, error) {
+		value, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		return map[Key]V{key: value}, nil
+	})
+
+	return res[key], err
+}
+
+// FetchMany is Fetch for several keys at once, allowing fetch to batch the upstream request for every key that needs
+// it. Keys already being fetched by a concurrent call wait on that call rather than being fetched again, so
+// overlapping calls share the upstream request for the keys they have in common. Values that could be found are
+// returned even if fetch fails, the error is every failed fetch the keys waited on joined together
+func FetchMany[V any](c *Cache, keys []Key, fetch func([]Key) (map[Key]V, error)) (map[Key]V, error) {
+	res := make(map[Key]V)
+	var missing, stale []Key
+
+	for _, key := range keys {
+		value, state := c.Get(key)
+		typed, ok := value.(V)
+		switch {
+		case state == Missing || !ok:
+			missing = append(missing, key)
+			continue
+		case state == Stale:
+			stale = append(stale, key)
+		}
+		res[key] = typed
+	}
+
+	if len(stale) > 0 {
+		go func() {
+			_, _ = refresh(c, stale, fetch)
+		}()
+	}
+
+	if len(missing) == 0 {
+		return res, nil
+	}
+
+	fetched, err := refresh(c, missing, fetch)
+	for key, value := range fetched {
+		res[key] = value
+	}
+
+	return res, err
+}
+
+// refresh calls fetch for the keys that aren't already being fetched and stores the results, waiting on the
+// concurrent fetches of the rest
+func refresh[V any](c *Cache, keys []Key, fetch func([]Key) (map[Key]V, error)) (map[Key]V, error) {
+	var claimed []Key
+	waiting := make(map[*flight][]Key)
+	own := &flight{done: make(chan struct{})}
+	c.mu.Lock()
+	for _, key := range keys {
+		if f, ok := c.flights[key]; ok {
+			waiting[f] = append(waiting[f], key)
+			continue
+		}
+		c.flights[key] = own
+		claimed = append(claimed, key)
+	}
+	c.mu.Unlock()
+
+	res := make(map[Key]V)
+	var errs []error
+	if len(claimed) > 0 {
+		values, err := fly(c, own, claimed, fetch)
+		for key, value := range values {
+			res[key] = value
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for f, keys := range waiting {
+		<-f.done
+		for _, key := range keys {
+			if value, ok := f.values[key].(V); ok {
+				res[key] = value
+			}
+		}
+		if f.err != nil {
+			errs = append(errs, f.err)
+		}
+	}
+
+	if len(errs) == 1 {
+		return res, errs[0]
+	}
+	return res, errors.Join(errs...)
+}
+
+// fly calls fetch for the keys claimed by f, storing what it returns and handing it to anyone waiting on f
+func fly[V any](c *Cache, f *flight, keys []Key, fetch func([]Key) (map[Key]V, error)) (values map[Key]V, err error) {
+	// release the claims even if fetch panics, otherwise anyone waiting on them would wait forever
+	defer func() {
+		f.values = make(map[Key]any, len(values))
+		for key, value := range values {
+			f.values[key] = value
+		}
+		f.err = err
+
+		c.mu.Lock()
+		for _, key := range keys {
+			delete(c.flights, key)
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	values, err = fetch(keys)
+	for key, value := range values {
+		c.Set(key, value)
+	}
+	return values, err
+}
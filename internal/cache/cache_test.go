@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	c := New(map[Product]Policy{Metar: {TTL: time.Minute, Stale: time.Minute}})
+	now := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	key := Key{Source: "test", Site: "CYXE", Product: Metar}
+	calls := 0
+	fetch := func() (string, error) {
+		calls++
+		return "METAR CYXE", nil
+	}
+
+	for range 3 {
+		value, err := Fetch(c, key, fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != "METAR CYXE" {
+			t.Fatalf("expected %q got %q", "METAR CYXE", value)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected fresh values to be served from the cache, fetched %d times", calls)
+	}
+
+	now = now.Add(3 * time.Minute)
+	if _, state := c.Get(key); state != Missing {
+		t.Fatalf("expected value to expire after TTL + Stale, got state %d", state)
+	}
+}
+
+func TestFetchStale(t *testing.T) {
+	c := New(map[Product]Policy{Metar: {TTL: time.Minute, Stale: time.Minute}})
+	now := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	key := Key{Source: "test", Site: "CYXE", Product: Metar}
+	c.Set(key, "old")
+	now = now.Add(90 * time.Second)
+
+	refreshed := make(chan struct{})
+	value, err := Fetch(c, key, func() (string, error) {
+		defer close(refreshed)
+		return "new", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "old" {
+		t.Fatalf("expected stale value to be served got %q", value)
+	}
+
+	<-refreshed
+	// Set happens after fetch returns, so wait for the background refresh to store it
+	for range 100 {
+		if value, state := c.Get(key); state == Fresh && value == "new" {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expected stale value to be refreshed in the background")
+}
+
+func TestFetchDeduplicates(t *testing.T) {
+	c := New(DefaultPolicies)
+	key := Key{Source: "test", Site: "CYXE", Product: Metar}
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fetch := func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "METAR CYXE", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = Fetch(c, key, fetch)
+		}()
+	}
+
+	// give every goroutine a chance to join the in-flight request
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected concurrent fetches to share one request, got %d", calls.Load())
+	}
+}
+
+func TestFetchManyOverlapping(t *testing.T) {
+	c := New(DefaultPolicies)
+	key := func(site string) Key { return Key{Source: "test", Site: site, Product: Metar} }
+
+	var mu sync.Mutex
+	var fetched [][]Key
+	release := make(chan struct{})
+	fetch := func(keys []Key) (map[Key]string, error) {
+		mu.Lock()
+		fetched = append(fetched, keys)
+		mu.Unlock()
+		<-release
+		res := make(map[Key]string)
+		for _, key := range keys {
+			res[key] = "METAR " + key.Site
+		}
+		return res, nil
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = FetchMany(c, []Key{key("CYXE"), key("CYVT")}, fetch)
+	}()
+	// let the first call claim its keys before the overlapping one starts
+	time.Sleep(50 * time.Millisecond)
+
+	var res map[Key]string
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		res, _ = FetchMany(c, []Key{key("CYVT"), key("CYPA")}, fetch)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if len(fetched) != 2 || len(fetched[1]) != 1 || fetched[1][0] != key("CYPA") {
+		t.Fatalf("expected CYVT to only be fetched once got %v", fetched)
+	}
+	if res[key("CYVT")] != "METAR CYVT" || res[key("CYPA")] != "METAR CYPA" {
+		t.Fatalf("expected both sites got %v", res)
+	}
+}
+
+func TestSetPrunesExpired(t *testing.T) {
+	c := New(map[Product]Policy{Metar: {TTL: time.Minute, Stale: time.Minute}})
+	now := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	c.Set(Key{Source: "test", Site: "CYXE", Product: Metar}, "old")
+	now = now.Add(pruneInterval)
+	c.Set(Key{Source: "test", Site: "CYVT", Product: Metar}, "new")
+
+	if len(c.entries) != 1 {
+		t.Fatalf("expected the expired entry to be dropped got %v", c.entries)
+	}
+}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"errors"
+	"golang.org/x/sync/singleflight"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Disk keeps products that never change once published, e.g. GFA images, as files named by their id
+type Disk struct {
+	dir   string
+	group singleflight.Group
+}
+
+// NewDisk stores files in dir, creating it if it doesn't exist yet
+func NewDisk(dir string) (*Disk, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Disk{dir: dir}, nil
+}
+
+// Fetch returns the file name and when it was stored, calling fetch to populate it if it is missing. name must not
+// contain a path separator. Concurrent calls for the same name share a single call to fetch
+func (d *Disk) Fetch(name string, fetch func() ([]byte, error)) ([]byte, time.Time, error) {
+	if name == "" || name != filepath.Base(name) {
+		return nil, time.Time{}, errors.New("invalid cache file name " + name)
+	}
+	path := filepath.Join(d.dir, name)
+
+	data, stored, err := read(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return data, stored, err
+	}
+
+	type result struct {
+		data   []byte
+		stored time.Time
+	}
+
+	out, err, _ := d.group.Do(name, func() (any, error) {
+		data, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		// written to a temporary file first so a partial write is never served
+		tmp, err := os.CreateTemp(d.dir, name+".*.tmp")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(data)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.Rename(tmp.Name(), path)
+		if err != nil {
+			return nil, err
+		}
+		return result{data, time.Now()}, nil
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	r := out.(result)
+	return r.data, r.stored, nil
+}
+
+func read(path string) ([]byte, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	return data, info.ModTime(), err
+}
+
+// Prune removes every file stored more than maxAge ago
+func (d *Disk) Prune(maxAge time.Duration) error {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		errs = append(errs, os.Remove(filepath.Join(d.dir, entry.Name())))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskFetch(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := NewDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	fetch := func() ([]byte, error) {
+		calls++
+		return []byte("png"), nil
+	}
+
+	for range 3 {
+		data, stored, err := disk.Fetch("56716267", fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "png" || stored.IsZero() {
+			t.Fatalf("expected the fetched file got %q stored at %s", data, stored)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected stored files to be served from disk, fetched %d times", calls)
+	}
+
+	// failures aren't stored
+	_, _, err = disk.Fetch("56716275", func() ([]byte, error) { return nil, errors.New("upstream down") })
+	if err == nil {
+		t.Fatal("expected the fetch error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "56716275")); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be stored for a failed fetch got %v", err)
+	}
+
+	if _, _, err := disk.Fetch("../escape", fetch); err == nil {
+		t.Fatal("expected names with a path to be rejected")
+	}
+}
+
+func TestDiskPrune(t *testing.T) {
+	dir := t.TempDir()
+	disk, err := NewDisk(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"old", "new"} {
+		_, _, err := disk.Fetch(name, func() ([]byte, error) { return []byte(name), nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-72 * time.Hour)
+	err = os.Chtimes(filepath.Join(dir, "old"), old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = disk.Prune(48 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "new" {
+		t.Fatalf("expected only new to be left got %v", entries)
+	}
+}
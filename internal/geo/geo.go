@@ -0,0 +1,110 @@
+// Package geo holds the positions of the sites we serve and the great circle maths used to compare them
+package geo
+
+import (
+	"math"
+)
+
+const earthRadiusNm = 3440.065
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance is the great circle distance between a and b in nautical miles
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat, dLon := lat2-lat1, radians(b.Lon-a.Lon)
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusNm * math.Asin(math.Sqrt(h))
+}
+
+// Bearing is the initial great circle bearing from a to b in degrees true
+func Bearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLon := radians(b.Lon - a.Lon)
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// Destination is the point distance nautical miles from p along the great circle starting at bearing degrees true
+func Destination(p Point, bearing, distance float64) Point {
+	lat1, lon1 := radians(p.Lat), radians(p.Lon)
+	angular, theta := distance/earthRadiusNm, radians(bearing)
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angular) + math.Cos(lat1)*math.Sin(angular)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(angular)*math.Cos(lat1), math.Cos(angular)-math.Sin(lat1)*math.Sin(lat2))
+	return Point{Lat: degrees(lat2), Lon: math.Mod(degrees(lon2)+540, 360) - 180}
+}
+
+// Stations are the aerodrome reference points of every site we serve and the upper wind stations around them
+var Stations = map[string]Point{
+	// Saskatchewan
+	"CYXE": {52.1708, -106.6997}, // Saskatoon
+	"CYQR": {50.4319, -104.6658}, // Regina
+	"CYPA": {53.2142, -105.6728}, // Prince Albert
+	"CYYN": {50.2919, -107.6906}, // Swift Current
+	"CYQV": {51.2647, -102.4617}, // Yorkton
+	"CYQW": {52.7692, -108.2436}, // North Battleford
+	"CYLJ": {54.1253, -108.5228}, // Meadow Lake
+	"CYVC": {55.1514, -105.2619}, // La Ronge
+	"CYHB": {52.8167, -102.3114}, // Hudson Bay
+	"CYVT": {55.8419, -108.4175}, // Buffalo Narrows
+	"CJL4": {56.4733, -109.4044}, // La Loche
+	"CKB2": {55.8997, -107.7206}, // Patuanak
+	"CJF3": {55.4897, -107.9300}, // Ile-a-la-Crosse
+	"CZPO": {55.5281, -106.5822}, // Pinehouse Lake
+	"CJY4": {55.7286, -102.2761}, // Sandy Bay
+	"CJW4": {55.2867, -102.7500}, // Pelican Narrows
+	"CJT4": {53.9564, -102.2981}, // Cumberland House
+	"CYKJ": {57.2561, -105.6178}, // Key Lake
+	"CKQ8": {57.7669, -105.0247}, // McArthur River
+	"CJW7": {58.0531, -104.4839}, // Cigar Lake
+	"CYNL": {58.2767, -104.0822}, // Points North Landing
+	"CZWL": {58.1069, -103.1719}, // Wollaston Lake
+	"CYSF": {59.2503, -105.8414}, // Stony Rapids
+	"CZFD": {59.3344, -107.1822}, // Fond-du-Lac
+	"CYBE": {59.5614, -108.4808}, // Uranium City
+
+	// Alberta
+	"CYXH": {50.0189, -110.7208}, // Medicine Hat
+	"CYQL": {49.6303, -112.7997}, // Lethbridge
+	"CYYC": {51.1225, -114.0133}, // Calgary
+	"CYEG": {53.3097, -113.5797}, // Edmonton
+	"CYLL": {53.3092, -110.0728}, // Lloydminster
+	"CYOD": {54.4050, -110.2794}, // Cold Lake
+	"CET2": {55.6953, -111.2789}, // Conklin (Leismer)
+	"CYMM": {56.6533, -111.2219}, // Fort McMurray
+	"CYPE": {56.2269, -117.4472}, // Peace River
+	"CYPY": {58.7672, -111.1172}, // Fort Chipewyan
+
+	// Manitoba
+	"CYWG": {49.9100, -97.2399},  // Winnipeg
+	"CYBR": {49.9100, -99.9519},  // Brandon
+	"CYQD": {53.9714, -101.0911}, // The Pas
+	"CYFO": {54.6781, -101.6817}, // Flin Flon
+	"CYTH": {55.8011, -97.8642},  // Thompson
+	"CYYL": {56.8639, -101.0761}, // Lynn Lake
+
+	// Northwest Territories
+	"CYSM": {60.0203, -111.9619}, // Fort Smith
+	"CYZF": {62.4628, -114.4403}, // Yellowknife
+}
+
+// Lookup returns the position of site
+func Lookup(site string) (Point, bool) {
+	p, ok := Stations[site]
+	return p, ok
+}
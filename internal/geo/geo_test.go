@@ -0,0 +1,46 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected float64
+	}{
+		{"CYXE", "CYQR", 129.3},
+		{"CYXE", "CYXE", 0},
+		{"CYVT", "CJL4", 50.3},
+	}
+
+	for _, tc := range cases {
+		actual := Distance(Stations[tc.a], Stations[tc.b])
+		if math.Abs(actual-tc.expected) > 0.5 {
+			t.Fatalf("%s to %s: expected %.1fnm got %.1fnm", tc.a, tc.b, tc.expected, actual)
+		}
+		if reverse := Distance(Stations[tc.b], Stations[tc.a]); math.Abs(reverse-actual) > 1e-9 {
+			t.Fatalf("%s to %s: expected the same distance both ways got %f and %f", tc.a, tc.b, actual, reverse)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	from, to := Stations["CYXE"], Stations["CYQR"]
+	bearing := Bearing(from, to)
+	if math.Abs(bearing-143) > 1 {
+		t.Fatalf("expected Regina to be about 143 from Saskatoon got %.1f", bearing)
+	}
+
+	actual := Destination(from, bearing, Distance(from, to))
+	if Distance(actual, to) > 0.01 {
+		t.Fatalf("expected to arrive at %+v got %+v", to, actual)
+	}
+
+	// a minute of latitude is a nautical mile
+	north := Destination(Point{50, -106}, 360, 60)
+	if math.Abs(north.Lat-51) > 0.01 || math.Abs(north.Lon+106) > 1e-9 {
+		t.Fatalf("expected 51N 106W got %+v", north)
+	}
+}
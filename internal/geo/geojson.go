@@ -0,0 +1,54 @@
+package geo
+
+// FeatureCollection is a GeoJSON (RFC 7946) FeatureCollection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON Feature, Geometry is nil when where it applies isn't known
+type Feature struct {
+	Type       string    `json:"type"`
+	Geometry   *Geometry `json:"geometry"`
+	Properties any       `json:"properties"`
+}
+
+// Geometry is a GeoJSON geometry, Coordinates are longitude then latitude
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// NewFeatureCollection collects features, there is always a list even if it is empty
+func NewFeatureCollection(features ...Feature) FeatureCollection {
+	if features == nil {
+		features = []Feature{}
+	}
+	return FeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+func NewFeature(geometry *Geometry, properties any) Feature {
+	return Feature{Type: "Feature", Geometry: geometry, Properties: properties}
+}
+
+func (p Point) coordinates() [2]float64 {
+	return [2]float64{p.Lon, p.Lat}
+}
+
+// Geometry is p as a GeoJSON Point
+func (p Point) Geometry() *Geometry {
+	return &Geometry{Type: "Point", Coordinates: p.coordinates()}
+}
+
+// Geometry is poly as a GeoJSON Polygon, nil if poly is empty. GeoJSON rings are counterclockwise but most readers
+// accept either
+func (poly Polygon) Geometry() *Geometry {
+	if len(poly) == 0 {
+		return nil
+	}
+	ring := make([][2]float64, 0, len(poly))
+	for _, p := range poly {
+		ring = append(ring, p.coordinates())
+	}
+	return &Geometry{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+}
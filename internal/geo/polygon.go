@@ -0,0 +1,104 @@
+package geo
+
+import (
+	"math"
+)
+
+// circleSegments is how many sides a circle is approximated with
+const circleSegments = 16
+
+// A Polygon is a closed ring of points, the last point is the same as the first
+type Polygon []Point
+
+// NewPolygon closes points into a Polygon if they aren't already
+func NewPolygon(points ...Point) Polygon {
+	if len(points) > 0 && points[0] != points[len(points)-1] {
+		points = append(points, points[0])
+	}
+	return Polygon(points)
+}
+
+// Circle approximates the area within radius nautical miles of center
+func Circle(center Point, radius float64) Polygon {
+	var points []Point
+	for i := range circleSegments {
+		points = append(points, Destination(center, float64(i)*360/circleSegments, radius))
+	}
+	return NewPolygon(points...)
+}
+
+// Corridor approximates the area within width nautical miles either side of the line through points, including past
+// each end
+func Corridor(points []Point, width float64) Polygon {
+	switch len(points) {
+	case 0:
+		return nil
+	case 1:
+		return Circle(points[0], width)
+	}
+
+	// the direction of the line at each point, halfway between the segments either side of it
+	bearings := make([]float64, len(points))
+	for i := range points {
+		switch i {
+		case 0:
+			bearings[i] = Bearing(points[0], points[1])
+		case len(points) - 1:
+			bearings[i] = Bearing(points[i-1], points[i])
+		default:
+			in, out := Bearing(points[i-1], points[i]), Bearing(points[i], points[i+1])
+			bearings[i] = in + math.Remainder(out-in, 360)/2
+		}
+	}
+
+	last := len(points) - 1
+	ring := []Point{Destination(points[0], bearings[0]+180, width)}
+	for i := range points {
+		ring = append(ring, Destination(points[i], bearings[i]-90, width))
+	}
+	ring = append(ring, Destination(points[last], bearings[last], width))
+	for i := last; i >= 0; i-- {
+		ring = append(ring, Destination(points[i], bearings[i]+90, width))
+	}
+	return NewPolygon(ring...)
+}
+
+// Contains reports whether p is inside the polygon, treating latitude and longitude as flat which is close enough
+// for areas the size of a SIGMET
+func (poly Polygon) Contains(p Point) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) && p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Intersects reports whether the polygons overlap at all, including one being entirely inside the other
+func (poly Polygon) Intersects(other Polygon) bool {
+	if len(poly) == 0 || len(other) == 0 {
+		return false
+	}
+	if poly.Contains(other[0]) || other.Contains(poly[0]) {
+		return true
+	}
+
+	for i := 0; i+1 < len(poly); i++ {
+		for j := 0; j+1 < len(other); j++ {
+			if crosses(poly[i], poly[i+1], other[j], other[j+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// crosses reports whether the segments ab and cd cross, again treating latitude and longitude as flat
+func crosses(a, b, c, d Point) bool {
+	side := func(p, q, r Point) bool {
+		return (q.Lon-p.Lon)*(r.Lat-p.Lat)-(q.Lat-p.Lat)*(r.Lon-p.Lon) > 0
+	}
+	return side(c, d, a) != side(c, d, b) && side(a, b, c) != side(a, b, d)
+}
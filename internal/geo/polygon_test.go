@@ -0,0 +1,71 @@
+package geo
+
+import (
+	"testing"
+)
+
+func TestPolygonContains(t *testing.T) {
+	// around Saskatoon and Prince Albert but not Regina
+	poly := NewPolygon(Point{51.5, -107.5}, Point{53.5, -107.5}, Point{53.5, -105}, Point{51.5, -105})
+	if len(poly) != 5 || poly[0] != poly[4] {
+		t.Fatalf("expected the polygon to be closed got %v", poly)
+	}
+
+	for site, expected := range map[string]bool{"CYXE": true, "CYPA": true, "CYQR": false, "CYVT": false} {
+		if actual := poly.Contains(Stations[site]); actual != expected {
+			t.Fatalf("%s: expected contains to be %t", site, expected)
+		}
+	}
+}
+
+func TestCorridor(t *testing.T) {
+	line := []Point{Stations["CYXE"], Stations["CYPA"], Stations["CYVC"]}
+	corridor := Corridor(line, 20)
+
+	// beside the middle of each leg and just past each end
+	inside := []Point{
+		Destination(Stations["CYXE"], Bearing(Stations["CYXE"], Stations["CYPA"])+90, 15),
+		Destination(Stations["CYPA"], 0, 15),
+		Destination(Stations["CYXE"], Bearing(Stations["CYPA"], Stations["CYXE"]), 15),
+		Destination(Stations["CYVC"], Bearing(Stations["CYPA"], Stations["CYVC"]), 15),
+	}
+	for _, p := range inside {
+		if !corridor.Contains(p) {
+			t.Fatalf("expected %+v to be within 20nm of the line", p)
+		}
+	}
+
+	if corridor.Contains(Stations["CYQW"]) || corridor.Contains(Stations["CYQR"]) {
+		t.Fatal("expected sites far from the line to be outside")
+	}
+
+	circle := Corridor(line[:1], 20)
+	if len(circle) != circleSegments+1 || !circle.Contains(Stations["CYXE"]) {
+		t.Fatalf("expected a single point to be a circle got %v", circle)
+	}
+}
+
+func TestPolygonIntersects(t *testing.T) {
+	route := Corridor([]Point{Stations["CYXE"], Stations["CYVT"]}, 20)
+
+	cases := []struct {
+		name     string
+		area     Polygon
+		expected bool
+	}{
+		{"across the route", NewPolygon(Point{53, -109}, Point{54, -109}, Point{54, -106}, Point{53, -106}), true},
+		{"around Buffalo Narrows", Circle(Stations["CYVT"], 10), true},
+		{"containing the whole route", Circle(Stations["CYLJ"], 300), true},
+		{"over Regina", Circle(Stations["CYQR"], 30), false},
+		{"nothing", nil, false},
+	}
+
+	for _, tc := range cases {
+		if actual := route.Intersects(tc.area); actual != tc.expected {
+			t.Fatalf("%s: expected %t got %t", tc.name, tc.expected, actual)
+		}
+		if actual := tc.area.Intersects(route); actual != tc.expected {
+			t.Fatalf("%s reversed: expected %t got %t", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Package history keeps every observation that is scraped so the weather at a site can be looked up after the fact,
+// most of the rural sources only publish their latest few reports
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"scuffed-v2/internal/metar"
+	"time"
+)
+
+const fileName = "observations.db"
+
+// observationsBucket holds a bucket per station, keyed by issue time
+var observationsBucket = []byte("observations")
+
+// A Record is an observation along with the source it was scraped from
+type Record struct {
+	Source string `json:"source"`
+	metar.Observation
+}
+
+// Store keeps records on disk keyed by station and issue time. Each station + issue time is only stored once, unless
+// a correction for it comes in later which replaces it
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens the store in dir, creating it if it doesn't exist yet
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, fileName), 0o644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(observationsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Add stores every observation that isn't already in the store, returning how many were new
+func (s *Store) Add(source string, observations ...metar.Observation) (int, error) {
+	added := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		stations := tx.Bucket(observationsBucket)
+		for _, obs := range observations {
+			if obs.Station == "" || obs.Time.IsZero() {
+				continue
+			}
+
+			bucket, err := stations.CreateBucketIfNotExists([]byte(obs.Station))
+			if err != nil {
+				return err
+			}
+
+			k := timeKey(obs.Time)
+			if existing := bucket.Get(k); existing != nil && !replaces(obs, existing) {
+				continue
+			}
+
+			value, err := json.Marshal(Record{Source: source, Observation: obs})
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(k, value)
+			if err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// replaces reports whether obs should replace the stored record for the same time, only corrections replace an
+// original report
+func replaces(obs metar.Observation, existing []byte) bool {
+	if !obs.Corrected {
+		return false
+	}
+	var rec Record
+	return json.Unmarshal(existing, &rec) != nil || !rec.Corrected
+}
+
+// Query returns the records for station issued in [from, to], oldest first
+func (s *Store) Query(station string, from, to time.Time) ([]Record, error) {
+	res := []Record{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(observationsBucket).Bucket([]byte(station))
+		if bucket == nil {
+			return nil
+		}
+
+		end := binary.BigEndian.Uint64(timeKey(to))
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(timeKey(from)); k != nil && binary.BigEndian.Uint64(k) <= end; k, v = cursor.Next() {
+			var rec Record
+			err := json.Unmarshal(v, &rec)
+			if err != nil {
+				return fmt.Errorf("decoding %s record: %w", station, err)
+			}
+			res = append(res, rec)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// timeKey sorts records by issue time, to the second, times before 1970 are clamped to it
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(max(t.Unix(), 0)))
+	return k
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"scuffed-v2/internal/metar"
+	"testing"
+	"time"
+)
+
+var ref = time.Date(2025, 6, 25, 2, 0, 0, 0, time.UTC)
+
+func parse(t *testing.T, raw string) metar.Observation {
+	t.Helper()
+	obs, err := metar.Parse(raw, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obs
+}
+
+func TestStoreDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	first := parse(t, "METAR CYXE 250000Z 31012KT 15SM FEW030 21/05 A2992")
+	second := parse(t, "METAR CYXE 250100Z 31010KT 15SM FEW030 20/05 A2993")
+
+	added, err := store.Add("navcanada", first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 {
+		t.Fatalf("expected 2 new records got %d", added)
+	}
+
+	// the same reports from another source, or the next poll, aren't stored twice
+	added, err = store.Add("highways", second, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 {
+		t.Fatalf("expected no new records got %d", added)
+	}
+
+	corrected := parse(t, "METAR CYXE 250100Z CCA 31010KT 15SM BKN030 20/05 A2993")
+	added, err = store.Add("navcanada", corrected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 {
+		t.Fatalf("expected the correction to be stored got %d", added)
+	}
+
+	records, err := store.Query("CYXE", first.Time, second.Time)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records got %d", len(records))
+	}
+	if records[0].Raw != first.Raw || records[1].Raw != corrected.Raw {
+		t.Fatalf("expected the original then the correction got %q and %q", records[0].Raw, records[1].Raw)
+	}
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, raw := range []string{
+		"METAR CYXE 250200Z 31012KT 15SM FEW030 21/05 A2992",
+		"METAR CYXE 250000Z 31012KT 15SM FEW030 21/05 A2992",
+		"METAR CJY4 250100Z AUTO 27005KT 9SM CLR 18/04 A2990",
+		"METAR CYXE 250100Z 31012KT 15SM FEW030 21/05 A2992",
+	} {
+		_, err = store.Add("navcanada", parse(t, raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	from := time.Date(2025, 6, 25, 0, 30, 0, 0, time.UTC)
+	records, err := store.Query("CYXE", from, from.Add(2*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records got %d", len(records))
+	}
+	if records[0].Time.Hour() != 1 || records[1].Time.Hour() != 2 {
+		t.Fatalf("expected records in time order got %s and %s", records[0].Time, records[1].Time)
+	}
+	if records[0].Source != "navcanada" || records[0].Temperature == nil || *records[0].Temperature != 21 {
+		t.Fatalf("expected the decoded observation to be stored got %+v", records[0])
+	}
+
+	if records, err := store.Query("CJY4", time.Time{}, ref); err != nil || len(records) != 1 {
+		t.Fatalf("expected 1 record for CJY4 got %d", len(records))
+	}
+
+	// records added after reopening are kept alongside the earlier ones
+	_, err = store.Add("navcanada", parse(t, "METAR CJY4 250200Z AUTO 27005KT 9SM CLR 18/04 A2990"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if records, err := store.Query("CJY4", time.Time{}, ref); err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records for CJY4 got %d", len(records))
+	}
+}
@@ -0,0 +1,127 @@
+package metar
+
+import (
+	"time"
+)
+
+type FlightCategory string
+
+const (
+	Unknown FlightCategory = "UNKNOWN"
+	VFR     FlightCategory = "VFR"
+	MVFR    FlightCategory = "MVFR"
+	IFR     FlightCategory = "IFR"
+	LIFR    FlightCategory = "LIFR"
+)
+
+var FlightCategories = []FlightCategory{VFR, MVFR, IFR, LIFR}
+
+// HourlyCategory is the flight category forecast for the hour starting at Time
+type HourlyCategory struct {
+	Time       time.Time      `json:"time"`
+	Prevailing FlightCategory `json:"prevailing"`
+	// Worst includes any TEMPO or PROB groups in effect during the hour
+	Worst FlightCategory `json:"worst"`
+}
+
+// rank orders categories from best to worst, Unknown is treated as better than VFR so it never wins a comparison
+func (f FlightCategory) rank() int {
+	switch f {
+	case VFR:
+		return 1
+	case MVFR:
+		return 2
+	case IFR:
+		return 3
+	case LIFR:
+		return 4
+	}
+	return 0
+}
+
+// Worse reports whether f is a more restrictive category than other
+func (f FlightCategory) Worse(other FlightCategory) bool {
+	return f.rank() > other.rank()
+}
+
+// Category determines the flight category from a ceiling (nil for unlimited) and visibility
+func Category(ceiling *int, visibility *Visibility) FlightCategory {
+	ceilingCategory, visibilityCategory := VFR, Unknown
+
+	if ceiling != nil {
+		switch {
+		case *ceiling < 500:
+			ceilingCategory = LIFR
+		case *ceiling < 1000:
+			ceilingCategory = IFR
+		case *ceiling <= 3000:
+			ceilingCategory = MVFR
+		}
+	}
+
+	if visibility != nil {
+		switch {
+		case visibility.Miles < 1:
+			visibilityCategory = LIFR
+		case visibility.Miles < 3:
+			visibilityCategory = IFR
+		case visibility.Miles <= 5:
+			visibilityCategory = MVFR
+		default:
+			visibilityCategory = VFR
+		}
+	}
+
+	if visibilityCategory.Worse(ceilingCategory) {
+		return visibilityCategory
+	}
+	return ceilingCategory
+}
+
+// Ceiling is the base of the lowest broken or overcast layer or vertical visibility, nil if there isn't one
+func (c Conditions) Ceiling() *int {
+	var ceiling *int
+	for _, sky := range c.Sky {
+		if sky.Cover != "BKN" && sky.Cover != "OVC" && sky.Cover != "VV" {
+			continue
+		}
+		if sky.Base != nil && (ceiling == nil || *sky.Base < *ceiling) {
+			ceiling = sky.Base
+		}
+	}
+	return ceiling
+}
+
+// FlightCategory is Unknown when neither the sky condition nor the visibility were reported
+func (c Conditions) FlightCategory() FlightCategory {
+	if c.Sky == nil && c.Visibility == nil {
+		return Unknown
+	}
+	return Category(c.Ceiling(), c.Visibility)
+}
+
+// HourlyCategories returns the forecast flight category for each hour of the TAF's validity
+func (t *TAF) HourlyCategories() []HourlyCategory {
+	var res []HourlyCategory
+
+	for hour := t.ValidFrom.Truncate(time.Hour); hour.Before(t.ValidTo); hour = hour.Add(time.Hour) {
+		forecast, ok := t.At(hour)
+		if !ok {
+			continue
+		}
+
+		hourly := HourlyCategory{Time: hour, Prevailing: forecast.Prevailing.FlightCategory()}
+		hourly.Worst = hourly.Prevailing
+		for _, group := range forecast.Temporary {
+			// temporary groups only list what changes, so fill in the rest from what's prevailing
+			category := forecast.Prevailing.merge(group.Conditions).FlightCategory()
+			if category.Worse(hourly.Worst) {
+				hourly.Worst = category
+			}
+		}
+
+		res = append(res, hourly)
+	}
+
+	return res
+}
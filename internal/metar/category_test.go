@@ -0,0 +1,52 @@
+package metar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObservationFlightCategory(t *testing.T) {
+	cases := []struct {
+		raw      string
+		expected FlightCategory
+	}{
+		{"METAR CYXE 242300Z 31012KT 15SM FEW030 BKN080 21/05 A2992", VFR},
+		{"METAR CYXE 242300Z 31012KT 15SM BKN025 21/05 A2992", MVFR},
+		{"METAR CYXE 242300Z 31012KT 4SM -RA SCT010 21/05 A2992", MVFR},
+		{"METAR CYXE 242300Z 31012KT 15SM OVC008 21/05 A2992", IFR},
+		{"METAR CYXE 242300Z 31012KT 2SM BR FEW100 21/05 A2992", IFR},
+		{"METAR CYXE 242300Z 31012KT 1/2SM FG VV002 21/05 A2992", LIFR},
+		{"METAR CYXE 242300Z 31012KT 21/05 A2992", Unknown},
+	}
+
+	for _, tc := range cases {
+		obs, err := Parse(tc.raw, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := obs.FlightCategory(); actual != tc.expected {
+			t.Fatalf("%q: expected %s got %s", tc.raw, tc.expected, actual)
+		}
+	}
+}
+
+func TestTAFHourlyCategories(t *testing.T) {
+	taf, err := ParseTAF(testTaf, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hourly := taf.HourlyCategories()
+	if len(hourly) != 24 {
+		t.Fatalf("expected 24 hours got %d", len(hourly))
+	}
+
+	// 0600Z-1000Z has a PROB30 2SM BR OVC008
+	probHour := hourly[12]
+	if expected := time.Date(2025, 6, 25, 6, 0, 0, 0, time.UTC); !probHour.Time.Equal(expected) {
+		t.Fatalf("expected hour %s got %s", expected, probHour.Time)
+	}
+	if probHour.Prevailing != VFR || probHour.Worst != IFR {
+		t.Fatalf("expected VFR prevailing and IFR worst got %s and %s", probHour.Prevailing, probHour.Worst)
+	}
+}
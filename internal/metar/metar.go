@@ -0,0 +1,388 @@
+package metar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReportType string
+
+const (
+	Metar ReportType = "METAR"
+	Speci ReportType = "SPECI"
+	Lwis  ReportType = "LWIS"
+)
+
+// Observation is a decoded METAR, SPECI or LWIS report
+type Observation struct {
+	Raw       string     `json:"raw"`
+	Type      ReportType `json:"type"`
+	Station   string     `json:"station"`
+	Time      time.Time  `json:"time"`
+	Auto      bool       `json:"auto"`
+	Corrected bool       `json:"corrected"`
+
+	Conditions
+	RunwayVisualRange []string `json:"runway_visual_range,omitempty"`
+	Temperature       *int     `json:"temperature,omitempty"` // celsius
+	Dewpoint          *int     `json:"dewpoint,omitempty"`    // celsius
+	Altimeter         *float64 `json:"altimeter,omitempty"`   // inHg
+
+	Remarks          string        `json:"remarks,omitempty"`
+	RemarkLayers     []RemarkLayer `json:"remark_layers,omitempty"`
+	SeaLevelPressure *float64      `json:"sea_level_pressure,omitempty"` // hPa
+
+	// Unparsed holds any groups in the body of the report that weren't recognized
+	Unparsed []string `json:"unparsed,omitempty"`
+}
+
+// Conditions are the elements shared between an Observation and a forecast
+type Conditions struct {
+	Wind               *Wind          `json:"wind,omitempty"`
+	Visibility         *Visibility    `json:"visibility,omitempty"`
+	Weather            []string       `json:"weather,omitempty"`
+	Sky                []SkyCondition `json:"sky,omitempty"`
+	VerticalVisibility *int           `json:"vertical_visibility,omitempty"` // feet
+}
+
+type Wind struct {
+	Direction    int  `json:"direction"` // degrees true, 0 when Variable
+	Variable     bool `json:"variable"`
+	Speed        int  `json:"speed"` // knots
+	Gust         int  `json:"gust,omitempty"`
+	VariableFrom int  `json:"variable_from,omitempty"`
+	VariableTo   int  `json:"variable_to,omitempty"`
+}
+
+type Visibility struct {
+	Miles       float64 `json:"miles"`        // statute miles
+	LessThan    bool    `json:"less_than"`    // M1/4SM
+	GreaterThan bool    `json:"greater_than"` // P6SM
+}
+
+type SkyCondition struct {
+	Cover string `json:"cover"`           // FEW, SCT, BKN, OVC, CLR, SKC, NCD, NSC
+	Base  *int   `json:"base,omitempty"`  // feet AGL
+	Cloud string `json:"cloud,omitempty"` // CB, TCU
+}
+
+// A RemarkLayer is the cloud type and opacity in oktas Canadian stations report in RMK, e.g. SC4AC2
+type RemarkLayer struct {
+	Type  string `json:"type"`
+	Oktas int    `json:"oktas"`
+}
+
+const (
+	metresPerStatuteMile = 1609.344
+	hPaPerInHg           = 33.8639
+)
+
+var (
+	stationRegex     = regexp.MustCompile(`^[A-Z][A-Z0-9]{3}$`)
+	timeRegex        = regexp.MustCompile(`^(\d{2})(\d{2})(\d{2})Z$`)
+	windRegex        = regexp.MustCompile(`^(\d{3}|VRB)(\d{2,3})(?:G(\d{2,3}))?(KT|MPS|KMH)$`)
+	windVarRegex     = regexp.MustCompile(`^(\d{3})V(\d{3})$`)
+	visMilesRegex    = regexp.MustCompile(`^(M|P)?(\d+)?(?:(\d)/(\d{1,2}))?SM$`)
+	visMetresRegex   = regexp.MustCompile(`^(\d{4})(?:NDV)?$`)
+	rvrRegex         = regexp.MustCompile(`^R\d{2}[LRC]?/`)
+	skyRegex         = regexp.MustCompile(`^(FEW|SCT|BKN|OVC|VV)(\d{3}|///)(CB|TCU|///)?$`)
+	tempRegex        = regexp.MustCompile(`^(M?\d{2})/(M?\d{2})?$`)
+	altimeterRegex   = regexp.MustCompile(`^A(\d{4})$`)
+	qnhRegex         = regexp.MustCompile(`^Q(\d{4})$`)
+	slpRegex         = regexp.MustCompile(`^SLP(\d{3})$`)
+	remarkLayerRegex = regexp.MustCompile(`(ACC|CI|CS|CC|AS|AC|SC|NS|ST|SF|CU|CF|TCU|CB|FG|BR|HZ|FU|SN|RA|DZ|SA|IC)(\d)`)
+	remarkGroupRegex = regexp.MustCompile(`^(?:(?:ACC|CI|CS|CC|AS|AC|SC|NS|ST|SF|CU|CF|TCU|CB|FG|BR|HZ|FU|SN|RA|DZ|SA|IC)\d)+$`)
+	weatherRegex     = regexp.MustCompile(`^(?:\+|-|VC|RE)?(?:MI|PR|BC|DR|BL|SH|TS|FZ)?(?:DZ|RA|SN|SG|IC|PL|GR|GS|UP|BR|FG|FU|VA|DU|SA|HZ|PY|PO|SQ|FC|SS|DS)*$`)
+)
+
+// Parse decodes a single raw METAR/SPECI/LWIS string. Reports only carry the day of the month, so ref
+// is used to resolve the month and year the report was issued in (normally the time it was retrieved)
+func Parse(raw string, ref time.Time) (Observation, error) {
+	obs := Observation{Raw: raw, Type: Metar}
+
+	body, remarks, _ := strings.Cut(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(raw), "=")), " RMK")
+	obs.Remarks = strings.TrimSpace(remarks)
+	parseRemarks(&obs)
+
+	tokens := strings.Fields(body)
+	if len(tokens) == 0 {
+		return Observation{}, fmt.Errorf("empty report")
+	}
+
+	// header: [METAR|SPECI|LWIS] [COR] STATION DDHHMMZ [AUTO|COR]
+	i := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i] {
+		case string(Metar), string(Speci), string(Lwis):
+			obs.Type = ReportType(tokens[i])
+			continue
+		case "COR", "CCA":
+			obs.Corrected = true
+			continue
+		}
+		break
+	}
+
+	if i >= len(tokens) || !stationRegex.MatchString(tokens[i]) {
+		return Observation{}, fmt.Errorf("no station identifier in %q", raw)
+	}
+	obs.Station = tokens[i]
+	i++
+
+	if i >= len(tokens) {
+		return Observation{}, fmt.Errorf("no issue time in %q", raw)
+	}
+	issued, err := resolveTime(tokens[i], ref)
+	if err != nil {
+		return Observation{}, err
+	}
+	obs.Time = issued
+	i++
+
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch {
+		case token == "AUTO":
+			obs.Auto = true
+		case token == "COR" || token == "CCA":
+			obs.Corrected = true
+		case token == "LWIS":
+			obs.Type = Lwis
+		case rvrRegex.MatchString(token):
+			obs.RunwayVisualRange = append(obs.RunwayVisualRange, token)
+		case tempRegex.MatchString(token):
+			m := tempRegex.FindStringSubmatch(token)
+			obs.Temperature = parseTemp(m[1])
+			obs.Dewpoint = parseTemp(m[2])
+		case altimeterRegex.MatchString(token):
+			hundredths, _ := strconv.Atoi(altimeterRegex.FindStringSubmatch(token)[1])
+			inHg := float64(hundredths) / 100
+			obs.Altimeter = &inHg
+		case qnhRegex.MatchString(token):
+			hPa, _ := strconv.Atoi(qnhRegex.FindStringSubmatch(token)[1])
+			inHg := float64(hPa) / hPaPerInHg
+			obs.Altimeter = &inHg
+		default:
+			consumed := obs.Conditions.parse(tokens, i)
+			if consumed == 0 {
+				obs.Unparsed = append(obs.Unparsed, token)
+				continue
+			}
+			i += consumed - 1
+		}
+	}
+
+	return obs, nil
+}
+
+// parse decodes the condition group starting at tokens[i], returning how many tokens it used or 0 if
+// tokens[i] isn't a condition group
+func (c *Conditions) parse(tokens []string, i int) int {
+	token := tokens[i]
+
+	switch {
+	case windRegex.MatchString(token):
+		c.Wind = parseWind(token)
+	case windVarRegex.MatchString(token) && c.Wind != nil:
+		m := windVarRegex.FindStringSubmatch(token)
+		c.Wind.VariableFrom, _ = strconv.Atoi(m[1])
+		c.Wind.VariableTo, _ = strconv.Atoi(m[2])
+	case token == "CAVOK":
+		c.Visibility = &Visibility{Miles: 10000 / metresPerStatuteMile}
+		c.Sky = append(c.Sky, SkyCondition{Cover: "NSC"})
+	case isWholeMiles(tokens, i):
+		// "1 1/2SM" is split over two tokens
+		vis, err := parseVisibility(tokens[i+1])
+		if err != nil {
+			return 0
+		}
+		vis.Miles += float64(token[0] - '0')
+		c.Visibility = vis
+		return 2
+	case visMilesRegex.MatchString(token):
+		vis, err := parseVisibility(token)
+		if err != nil {
+			return 0
+		}
+		c.Visibility = vis
+	case visMetresRegex.MatchString(token) && c.Visibility == nil:
+		metres, _ := strconv.Atoi(visMetresRegex.FindStringSubmatch(token)[1])
+		c.Visibility = &Visibility{Miles: float64(metres) / metresPerStatuteMile}
+	case token == "SKC" || token == "CLR" || token == "NCD" || token == "NSC":
+		c.Sky = append(c.Sky, SkyCondition{Cover: token})
+	case skyRegex.MatchString(token):
+		sky := parseSky(token)
+		if sky.Cover == "VV" {
+			c.VerticalVisibility = sky.Base
+		}
+		c.Sky = append(c.Sky, sky)
+	case token == "NSW":
+		// no significant weather, only used in forecasts to end previously forecast weather
+		c.Weather = []string{}
+	case isWeather(token):
+		c.Weather = append(c.Weather, token)
+	default:
+		return 0
+	}
+
+	return 1
+}
+
+// resolveTime converts a DDHHMMZ group to the matching time closest to ref
+func resolveTime(token string, ref time.Time) (time.Time, error) {
+	m := timeRegex.FindStringSubmatch(token)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid issue time %q", token)
+	}
+	day, _ := strconv.Atoi(m[1])
+	hour, _ := strconv.Atoi(m[2])
+	minute, _ := strconv.Atoi(m[3])
+
+	return resolveDay(day, hour, minute, ref)
+}
+
+// resolveDay places a day/hour/minute in the month before, of, or after ref, whichever is closest to ref
+func resolveDay(day, hour, minute int, ref time.Time) (time.Time, error) {
+	if day < 1 || day > 31 || hour > 24 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid day/time %02d%02d%02d", day, hour, minute)
+	}
+	ref = ref.UTC()
+
+	var closest time.Time
+	for _, monthOffset := range []time.Month{-1, 0, 1} {
+		month := time.Date(ref.Year(), ref.Month()+monthOffset, 1, 0, 0, 0, 0, time.UTC)
+		date := time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, time.UTC)
+		// day doesn't exist in this month (e.g. 31st of June)
+		if date.Month() != month.Month() {
+			continue
+		}
+
+		t := date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+		if closest.IsZero() || t.Sub(ref).Abs() < closest.Sub(ref).Abs() {
+			closest = t
+		}
+	}
+
+	return closest, nil
+}
+
+func parseWind(token string) *Wind {
+	m := windRegex.FindStringSubmatch(token)
+	wind := &Wind{}
+	if m[1] == "VRB" {
+		wind.Variable = true
+	} else {
+		wind.Direction, _ = strconv.Atoi(m[1])
+	}
+	wind.Speed, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		wind.Gust, _ = strconv.Atoi(m[3])
+	}
+
+	// everything is reported in knots
+	switch m[4] {
+	case "MPS":
+		wind.Speed = int(float64(wind.Speed)*1.94384 + 0.5)
+		wind.Gust = int(float64(wind.Gust)*1.94384 + 0.5)
+	case "KMH":
+		wind.Speed = int(float64(wind.Speed)/1.852 + 0.5)
+		wind.Gust = int(float64(wind.Gust)/1.852 + 0.5)
+	}
+
+	return wind
+}
+
+// isWholeMiles reports whether tokens[i] is the whole number half of a split visibility like "2 1/4SM"
+func isWholeMiles(tokens []string, i int) bool {
+	if i+1 >= len(tokens) || len(tokens[i]) != 1 || tokens[i][0] < '0' || tokens[i][0] > '9' {
+		return false
+	}
+	m := visMilesRegex.FindStringSubmatch(tokens[i+1])
+	return m != nil && m[1] == "" && m[2] == "" && m[3] != ""
+}
+
+// parseVisibility handles statute mile visibilities such as 15SM, 3/4SM, M1/4SM and P6SM
+func parseVisibility(token string) (*Visibility, error) {
+	m := visMilesRegex.FindStringSubmatch(token)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return nil, fmt.Errorf("invalid visibility %q", token)
+	}
+
+	vis := &Visibility{LessThan: m[1] == "M", GreaterThan: m[1] == "P"}
+	if m[2] != "" {
+		whole, _ := strconv.Atoi(m[2])
+		vis.Miles = float64(whole)
+	}
+	if m[3] != "" {
+		numerator, _ := strconv.Atoi(m[3])
+		denominator, _ := strconv.Atoi(m[4])
+		if denominator == 0 {
+			return nil, fmt.Errorf("invalid visibility %q", token)
+		}
+		vis.Miles += float64(numerator) / float64(denominator)
+	}
+
+	return vis, nil
+}
+
+func parseSky(token string) SkyCondition {
+	m := skyRegex.FindStringSubmatch(token)
+	sky := SkyCondition{Cover: m[1]}
+	if m[2] != "///" {
+		hundreds, _ := strconv.Atoi(m[2])
+		base := hundreds * 100
+		sky.Base = &base
+	}
+	if m[3] != "///" {
+		sky.Cloud = m[3]
+	}
+	return sky
+}
+
+func parseTemp(s string) *int {
+	if s == "" {
+		return nil
+	}
+	negative := strings.HasPrefix(s, "M")
+	v, err := strconv.Atoi(strings.TrimPrefix(s, "M"))
+	if err != nil {
+		return nil
+	}
+	if negative {
+		v = -v
+	}
+	return &v
+}
+
+func isWeather(token string) bool {
+	// a bare intensity/descriptor match is too permissive, a phenomenon or TS is required
+	if len(token) < 2 || token == "RE" || token == "VC" {
+		return false
+	}
+	return weatherRegex.MatchString(token)
+}
+
+// parseRemarks pulls out the Canadian cloud opacity layers and sea level pressure from RMK
+func parseRemarks(obs *Observation) {
+	for _, token := range strings.Fields(obs.Remarks) {
+		switch {
+		case remarkGroupRegex.MatchString(token):
+			for _, m := range remarkLayerRegex.FindAllStringSubmatch(token, -1) {
+				oktas, _ := strconv.Atoi(m[2])
+				obs.RemarkLayers = append(obs.RemarkLayers, RemarkLayer{Type: m[1], Oktas: oktas})
+			}
+		case slpRegex.MatchString(token):
+			tenths, _ := strconv.Atoi(slpRegex.FindStringSubmatch(token)[1])
+			// SLP only reports the last three digits, e.g. 142 -> 1014.2 and 987 -> 998.7
+			hPa := 1000 + float64(tenths)/10
+			if tenths >= 500 {
+				hPa = 900 + float64(tenths)/10
+			}
+			obs.SeaLevelPressure = &hPa
+		}
+	}
+}
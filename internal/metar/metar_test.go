@@ -0,0 +1,119 @@
+package metar
+
+import (
+	"testing"
+	"time"
+)
+
+var ref = time.Date(2025, 6, 25, 2, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	raw := "SPECI CJY4 250103Z AUTO 19006KT 170V240 1 1/2SM HZ NCD 23/06 A2980 RMK SLP096 DENSITY ALT 2274FT="
+
+	obs, err := Parse(raw, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obs.Type != Speci || obs.Station != "CJY4" || !obs.Auto {
+		t.Fatalf("unexpected header %q %q auto=%t", obs.Type, obs.Station, obs.Auto)
+	}
+	if expected := time.Date(2025, 6, 25, 1, 3, 0, 0, time.UTC); !obs.Time.Equal(expected) {
+		t.Fatalf("expected time %s got %s", expected, obs.Time)
+	}
+	if obs.Wind == nil || obs.Wind.Direction != 190 || obs.Wind.Speed != 6 || obs.Wind.VariableFrom != 170 || obs.Wind.VariableTo != 240 {
+		t.Fatalf("unexpected wind %+v", obs.Wind)
+	}
+	if obs.Visibility == nil || obs.Visibility.Miles != 1.5 {
+		t.Fatalf("expected 1.5SM visibility got %+v", obs.Visibility)
+	}
+	if len(obs.Weather) != 1 || obs.Weather[0] != "HZ" {
+		t.Fatalf("expected HZ got %v", obs.Weather)
+	}
+	if len(obs.Sky) != 1 || obs.Sky[0].Cover != "NCD" {
+		t.Fatalf("expected NCD got %+v", obs.Sky)
+	}
+	if *obs.Temperature != 23 || *obs.Dewpoint != 6 {
+		t.Fatalf("expected 23/06 got %d/%d", *obs.Temperature, *obs.Dewpoint)
+	}
+	if *obs.Altimeter != 29.80 {
+		t.Fatalf("expected altimeter 29.80 got %f", *obs.Altimeter)
+	}
+	if *obs.SeaLevelPressure != 1009.6 {
+		t.Fatalf("expected SLP 1009.6 got %f", *obs.SeaLevelPressure)
+	}
+	if len(obs.Unparsed) != 0 {
+		t.Fatalf("expected everything to be parsed, left with %v", obs.Unparsed)
+	}
+}
+
+func TestParseCanadianRemarks(t *testing.T) {
+	raw := "METAR CYXE 242300Z 31012G22KT 15SM -SHRA FEW030CB BKN080 OVC120 M02/M05 A2992 RMK CB2AC3SC2 SLP142="
+
+	obs, err := Parse(raw, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obs.Wind.Gust != 22 {
+		t.Fatalf("expected gust 22 got %d", obs.Wind.Gust)
+	}
+	if len(obs.Sky) != 3 || obs.Sky[0].Cloud != "CB" || *obs.Sky[1].Base != 8000 {
+		t.Fatalf("unexpected sky %+v", obs.Sky)
+	}
+	if *obs.Temperature != -2 || *obs.Dewpoint != -5 {
+		t.Fatalf("expected M02/M05 got %d/%d", *obs.Temperature, *obs.Dewpoint)
+	}
+
+	expectedLayers := []RemarkLayer{{"CB", 2}, {"AC", 3}, {"SC", 2}}
+	if len(obs.RemarkLayers) != len(expectedLayers) {
+		t.Fatalf("expected %v got %v", expectedLayers, obs.RemarkLayers)
+	}
+	for i := range expectedLayers {
+		if obs.RemarkLayers[i] != expectedLayers[i] {
+			t.Fatalf("expected %v got %v", expectedLayers, obs.RemarkLayers)
+		}
+	}
+}
+
+func TestParseVisibility(t *testing.T) {
+	cases := []struct {
+		raw      string
+		miles    float64
+		lessThan bool
+	}{
+		{"METAR CYSF 250000Z 00000KT 15SM SKC 20/05 A2990", 15, false},
+		{"METAR CYSF 250000Z 00000KT 3/4SM FG VV002 10/10 A2990", 0.75, false},
+		{"METAR CYSF 250000Z 00000KT M1/4SM FG VV001 10/10 A2990", 0.25, true},
+		{"METAR CYSF 250000Z 00000KT 2 1/4SM BR OVC004 10/10 A2990", 2.25, false},
+	}
+
+	for _, tc := range cases {
+		obs, err := Parse(tc.raw, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obs.Visibility == nil || obs.Visibility.Miles != tc.miles || obs.Visibility.LessThan != tc.lessThan {
+			t.Fatalf("%q: expected %v (less than %t) got %+v", tc.raw, tc.miles, tc.lessThan, obs.Visibility)
+		}
+	}
+}
+
+func TestParseResolvesPreviousMonth(t *testing.T) {
+	obs, err := Parse("METAR CYXE 302300Z 00000KT 15SM CLR 20/05 A2990", time.Date(2025, 7, 1, 0, 10, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC); !obs.Time.Equal(expected) {
+		t.Fatalf("expected %s got %s", expected, obs.Time)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, raw := range []string{"", "METAR", "METAR CYXE", "METAR CYXE 999999Z"} {
+		if _, err := Parse(raw, ref); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package metar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ChangeType string
+
+const (
+	Base  ChangeType = "BASE"
+	From  ChangeType = "FM"
+	Tempo ChangeType = "TEMPO"
+	Becmg ChangeType = "BECMG"
+	Prob  ChangeType = "PROB"
+)
+
+// TAF is a decoded terminal aerodrome forecast
+type TAF struct {
+	Raw       string    `json:"raw"`
+	Station   string    `json:"station"`
+	Issued    time.Time `json:"issued"`
+	Amended   bool      `json:"amended"`
+	Corrected bool      `json:"corrected"`
+	ValidFrom time.Time `json:"valid_from"`
+	ValidTo   time.Time `json:"valid_to"`
+
+	// Groups holds the base forecast first, followed by each change group in the order it was issued
+	Groups  []ForecastGroup `json:"groups"`
+	Remarks string          `json:"remarks,omitempty"`
+}
+
+// A ForecastGroup is the base forecast or a single FM, TEMPO, BECMG or PROB change group
+type ForecastGroup struct {
+	Change      ChangeType `json:"change"`
+	Probability int        `json:"probability,omitempty"` // 30 or 40 for PROB groups
+	Tempo       bool       `json:"tempo,omitempty"`       // PROB30 TEMPO
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Conditions
+	WindShear string `json:"wind_shear,omitempty"`
+
+	Unparsed []string `json:"unparsed,omitempty"`
+}
+
+// Forecast is what a TAF predicts at a single point in time
+type Forecast struct {
+	Time       time.Time  `json:"time"`
+	Prevailing Conditions `json:"prevailing"`
+	// Temporary holds the TEMPO and PROB groups in effect at Time and the BECMG groups still changing
+	Temporary []ForecastGroup `json:"temporary,omitempty"`
+}
+
+var (
+	periodRegex    = regexp.MustCompile(`^(\d{2})(\d{2})/(\d{2})(\d{2})$`)
+	fromRegex      = regexp.MustCompile(`^FM(\d{2})(\d{2})(\d{2})$`)
+	probRegex      = regexp.MustCompile(`^PROB(\d{2})$`)
+	windShearRegex = regexp.MustCompile(`^WS\d{3}/\d{5}KT$`)
+)
+
+// ParseTAF decodes a raw TAF. Like Parse, ref is used to resolve the month and year of the day-only times
+func ParseTAF(raw string, ref time.Time) (TAF, error) {
+	taf := TAF{Raw: raw}
+
+	body, remarks, _ := strings.Cut(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(raw), "=")), " RMK")
+	taf.Remarks = strings.TrimSpace(remarks)
+
+	tokens := strings.Fields(body)
+
+	// header: TAF [AMD|COR] STATION DDHHMMZ DDHH/DDHH
+	i := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "TAF":
+			continue
+		case "AMD":
+			taf.Amended = true
+			continue
+		case "COR", "CCA":
+			taf.Corrected = true
+			continue
+		}
+		break
+	}
+
+	if i >= len(tokens) || !stationRegex.MatchString(tokens[i]) {
+		return TAF{}, fmt.Errorf("no station identifier in %q", raw)
+	}
+	taf.Station = tokens[i]
+	i++
+
+	if i >= len(tokens) {
+		return TAF{}, fmt.Errorf("no issue time in %q", raw)
+	}
+	issued, err := resolveTime(tokens[i], ref)
+	if err != nil {
+		return TAF{}, err
+	}
+	taf.Issued = issued
+	i++
+
+	if i >= len(tokens) || !periodRegex.MatchString(tokens[i]) {
+		return TAF{}, fmt.Errorf("no validity period in %q", raw)
+	}
+	taf.ValidFrom, taf.ValidTo, err = resolvePeriod(tokens[i], issued)
+	if err != nil {
+		return TAF{}, err
+	}
+	i++
+
+	current := ForecastGroup{Change: Base, From: taf.ValidFrom, To: taf.ValidTo}
+	for ; i < len(tokens); i++ {
+		token := tokens[i]
+
+		var next *ForecastGroup
+		switch {
+		case fromRegex.MatchString(token):
+			m := fromRegex.FindStringSubmatch(token)
+			day, _ := strconv.Atoi(m[1])
+			hour, _ := strconv.Atoi(m[2])
+			minute, _ := strconv.Atoi(m[3])
+			from, err := resolveDay(day, hour, minute, issued)
+			if err != nil {
+				return TAF{}, err
+			}
+			next = &ForecastGroup{Change: From, From: from, To: taf.ValidTo}
+		case token == string(Tempo) || token == string(Becmg):
+			next = &ForecastGroup{Change: ChangeType(token)}
+		case probRegex.MatchString(token):
+			probability, _ := strconv.Atoi(probRegex.FindStringSubmatch(token)[1])
+			next = &ForecastGroup{Change: Prob, Probability: probability}
+			if i+1 < len(tokens) && tokens[i+1] == string(Tempo) {
+				next.Tempo = true
+				i++
+			}
+		case windShearRegex.MatchString(token):
+			current.WindShear = token
+			continue
+		default:
+			consumed := current.Conditions.parse(tokens, i)
+			if consumed == 0 {
+				current.Unparsed = append(current.Unparsed, token)
+				continue
+			}
+			i += consumed - 1
+			continue
+		}
+
+		// TEMPO, BECMG and PROB are followed by their own DDHH/DDHH validity
+		if next.Change != From {
+			if i+1 >= len(tokens) || !periodRegex.MatchString(tokens[i+1]) {
+				return TAF{}, fmt.Errorf("%s group without a validity period in %q", next.Change, raw)
+			}
+			i++
+			next.From, next.To, err = resolvePeriod(tokens[i], issued)
+			if err != nil {
+				return TAF{}, err
+			}
+		}
+
+		taf.Groups = append(taf.Groups, current)
+		current = *next
+	}
+	taf.Groups = append(taf.Groups, current)
+
+	// the base and each FM group run until the next FM group starts
+	lastPrevailing := 0
+	for j := 1; j < len(taf.Groups); j++ {
+		if taf.Groups[j].Change == From {
+			taf.Groups[lastPrevailing].To = taf.Groups[j].From
+			lastPrevailing = j
+		}
+	}
+
+	return taf, nil
+}
+
+// resolvePeriod converts a DDHH/DDHH group into start and end times relative to the issue time
+func resolvePeriod(token string, issued time.Time) (time.Time, time.Time, error) {
+	m := periodRegex.FindStringSubmatch(token)
+	if m == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q", token)
+	}
+
+	var values [4]int
+	for i := range values {
+		values[i], _ = strconv.Atoi(m[i+1])
+	}
+
+	start, err := resolveDay(values[0], values[1], 0, issued)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := resolveDay(values[2], values[3], 0, issued)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("period %q ends before it starts", token)
+	}
+
+	return start, end, nil
+}
+
+// At returns the forecast in effect at t, false is returned when t is outside the TAF's validity
+func (t *TAF) At(at time.Time) (Forecast, bool) {
+	if at.Before(t.ValidFrom) || !at.Before(t.ValidTo) {
+		return Forecast{}, false
+	}
+
+	res := Forecast{Time: at}
+	for _, group := range t.Groups {
+		switch group.Change {
+		case Base, From:
+			if !at.Before(group.From) {
+				res.Prevailing = group.Conditions
+			}
+		case Becmg:
+			// the change is only certain to be complete by the end of the period, during it either conditions may be
+			// in effect so the new ones are treated as temporary until then
+			if !at.Before(group.To) {
+				res.Prevailing = res.Prevailing.merge(group.Conditions)
+			} else if !at.Before(group.From) {
+				res.Temporary = append(res.Temporary, group)
+			}
+		case Tempo, Prob:
+			if !at.Before(group.From) && at.Before(group.To) {
+				res.Temporary = append(res.Temporary, group)
+			}
+		}
+	}
+
+	return res, true
+}
+
+// merge returns c with any elements set in change replacing the existing values
+func (c Conditions) merge(change Conditions) Conditions {
+	if change.Wind != nil {
+		c.Wind = change.Wind
+	}
+	if change.Visibility != nil {
+		c.Visibility = change.Visibility
+	}
+	if change.Weather != nil {
+		c.Weather = change.Weather
+	}
+	if change.Sky != nil {
+		c.Sky = change.Sky
+		c.VerticalVisibility = change.VerticalVisibility
+	}
+	return c
+}
@@ -0,0 +1,112 @@
+package metar
+
+import (
+	"testing"
+	"time"
+)
+
+const testTaf = "TAF CYXE 241740Z 2418/2518 27010KT P6SM FEW040 BKN100 " +
+	"TEMPO 2418/2422 5SM -SHRA BKN040 " +
+	"FM242200 30008KT P6SM SKC " +
+	"BECMG 2502/2504 VRB03KT " +
+	"PROB30 2506/2510 2SM BR OVC008 " +
+	"FM251400 18012G22KT P6SM SCT030 " +
+	"RMK NXT FCST BY 242300Z="
+
+func TestParseTAF(t *testing.T) {
+	taf, err := ParseTAF(testTaf, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if taf.Station != "CYXE" {
+		t.Fatalf("expected CYXE got %q", taf.Station)
+	}
+	if expected := time.Date(2025, 6, 24, 18, 0, 0, 0, time.UTC); !taf.ValidFrom.Equal(expected) {
+		t.Fatalf("expected valid from %s got %s", expected, taf.ValidFrom)
+	}
+	if expected := time.Date(2025, 6, 25, 18, 0, 0, 0, time.UTC); !taf.ValidTo.Equal(expected) {
+		t.Fatalf("expected valid to %s got %s", expected, taf.ValidTo)
+	}
+	if taf.Remarks != "NXT FCST BY 242300Z" {
+		t.Fatalf("unexpected remarks %q", taf.Remarks)
+	}
+
+	expectedChanges := []ChangeType{Base, Tempo, From, Becmg, Prob, From}
+	if len(taf.Groups) != len(expectedChanges) {
+		t.Fatalf("expected %d groups got %d: %+v", len(expectedChanges), len(taf.Groups), taf.Groups)
+	}
+	for i, change := range expectedChanges {
+		if taf.Groups[i].Change != change {
+			t.Fatalf("expected group %d to be %s got %s", i, change, taf.Groups[i].Change)
+		}
+		if len(taf.Groups[i].Unparsed) != 0 {
+			t.Fatalf("group %d has unparsed tokens %v", i, taf.Groups[i].Unparsed)
+		}
+	}
+
+	// base runs until the first FM group, which runs until the next
+	if expected := time.Date(2025, 6, 24, 22, 0, 0, 0, time.UTC); !taf.Groups[0].To.Equal(expected) {
+		t.Fatalf("expected base to end %s got %s", expected, taf.Groups[0].To)
+	}
+	if expected := time.Date(2025, 6, 25, 14, 0, 0, 0, time.UTC); !taf.Groups[2].To.Equal(expected) {
+		t.Fatalf("expected FM242200 to end %s got %s", expected, taf.Groups[2].To)
+	}
+	if taf.Groups[4].Probability != 30 {
+		t.Fatalf("expected PROB30 got %d", taf.Groups[4].Probability)
+	}
+}
+
+func TestTAFAt(t *testing.T) {
+	taf, err := ParseTAF(testTaf, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		at        time.Time
+		direction int
+		variable  bool
+		temporary int
+	}{
+		{time.Date(2025, 6, 24, 19, 0, 0, 0, time.UTC), 270, false, 1},
+		{time.Date(2025, 6, 24, 23, 0, 0, 0, time.UTC), 300, false, 0},
+		// still becoming variable, the new wind is temporary until the end of the BECMG
+		{time.Date(2025, 6, 25, 3, 0, 0, 0, time.UTC), 300, false, 1},
+		{time.Date(2025, 6, 25, 4, 0, 0, 0, time.UTC), 0, true, 0},
+		{time.Date(2025, 6, 25, 7, 0, 0, 0, time.UTC), 0, true, 1},
+		{time.Date(2025, 6, 25, 15, 0, 0, 0, time.UTC), 180, false, 0},
+	}
+
+	for _, tc := range cases {
+		forecast, ok := taf.At(tc.at)
+		if !ok {
+			t.Fatalf("expected %s to be within the TAF", tc.at)
+		}
+		wind := forecast.Prevailing.Wind
+		if wind.Direction != tc.direction || wind.Variable != tc.variable {
+			t.Fatalf("%s: expected wind %d (variable %t) got %+v", tc.at, tc.direction, tc.variable, wind)
+		}
+		if len(forecast.Temporary) != tc.temporary {
+			t.Fatalf("%s: expected %d temporary groups got %d", tc.at, tc.temporary, len(forecast.Temporary))
+		}
+	}
+
+	if _, ok := taf.At(time.Date(2025, 6, 25, 18, 0, 0, 0, time.UTC)); ok {
+		t.Fatal("expected the end of the validity period to be outside the TAF")
+	}
+}
+
+func TestParseTAFAcrossMonth(t *testing.T) {
+	taf, err := ParseTAF("TAF AMD CYQR 302340Z 3100/0106 VRB03KT P6SM SKC", time.Date(2025, 7, 31, 23, 45, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !taf.Amended {
+		t.Fatal("expected AMD to be decoded")
+	}
+	if expected := time.Date(2025, 8, 1, 6, 0, 0, 0, time.UTC); !taf.ValidTo.Equal(expected) {
+		t.Fatalf("expected valid to %s got %s", expected, taf.ValidTo)
+	}
+}
@@ -0,0 +1,181 @@
+// Package poller periodically runs jobs in the background so requests can be served from the cache
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// A Job is run every Interval, or at the time returned by Next when it is set. Interval is also where backing off
+// starts from when the job fails, so it should be set for scheduled jobs too
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Next optionally schedules the job at fixed times, e.g. when a product is issued
+	Next func(now time.Time) time.Time
+	// Jitter is the most that is randomly added to each run so jobs don't all hit upstream at once
+	Jitter time.Duration
+	Run    func(ctx context.Context) error
+}
+
+// Status is a snapshot of a job's runs
+type Status struct {
+	Name        string    `json:"name"`
+	LastRun     time.Time `json:"last_run"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	Failures    int       `json:"consecutive_failures"`
+	NextRun     time.Time `json:"next_run"`
+	Running     bool      `json:"running"`
+}
+
+type Scheduler struct {
+	// MaxBackoff caps how long a failing job waits between attempts
+	MaxBackoff time.Duration
+
+	mu     sync.Mutex
+	jobs   []Job
+	status map[string]*Status
+}
+
+func New() *Scheduler {
+	return &Scheduler{
+		MaxBackoff: time.Hour,
+		status:     make(map[string]*Status),
+	}
+}
+
+// Add registers job, it must be called before Start
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+	s.status[job.Name] = &Status{Name: job.Name}
+}
+
+// Start runs every job immediately and then on its schedule until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	jobs := slices.Clone(s.jobs)
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		go s.loop(ctx, job)
+	}
+}
+
+// Status returns the state of every job in the order they were added
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]Status, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		res = append(res, *s.status[job.Name])
+	}
+	return res
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		s.update(job.Name, func(st *Status) {
+			st.Running = true
+			st.LastRun = time.Now()
+		})
+
+		err := run(ctx, job)
+
+		var next time.Time
+		s.update(job.Name, func(st *Status) {
+			st.Running = false
+			if err != nil {
+				st.Failures++
+				st.LastError = err.Error()
+				slog.Error("Poll job failed",
+					slog.String("job", job.Name),
+					slog.Int("failures", st.Failures),
+					slog.String("err", err.Error()),
+				)
+			} else {
+				st.Failures = 0
+				st.LastError = ""
+				st.LastSuccess = st.LastRun
+			}
+			st.NextRun = s.next(job, st.Failures, time.Now())
+			next = st.NextRun
+		})
+
+		timer.Reset(time.Until(next))
+	}
+}
+
+// run calls job.Run, turning a panic into an error so one bad job doesn't take down the server
+func run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %s panicked: %v", job.Name, r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// next is when job should run again, failing jobs back off exponentially from their interval
+func (s *Scheduler) next(job Job, failures int, now time.Time) time.Time {
+	var jitter time.Duration
+	if job.Jitter > 0 {
+		jitter = rand.N(job.Jitter)
+	}
+
+	if failures > 0 {
+		backoff := job.Interval
+		for range failures - 1 {
+			backoff *= 2
+			if backoff >= s.MaxBackoff {
+				break
+			}
+		}
+		return now.Add(min(backoff, s.MaxBackoff) + jitter)
+	}
+
+	if job.Next != nil {
+		return job.Next(now).Add(jitter)
+	}
+	return now.Add(job.Interval + jitter)
+}
+
+func (s *Scheduler) update(name string, f func(*Status)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.status[name])
+}
+
+// AtHours returns a Job.Next that schedules the job at the next of hours (UTC) past the given minute
+func AtHours(minute int, hours ...int) func(time.Time) time.Time {
+	return func(now time.Time) time.Time {
+		now = now.UTC()
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, minute, 0, 0, time.UTC)
+		for _, offset := range []int{0, 1} {
+			for _, hour := range hours {
+				t := day.AddDate(0, 0, offset).Add(time.Duration(hour) * time.Hour)
+				if t.After(now) {
+					return t
+				}
+			}
+		}
+		return now.Add(24 * time.Hour)
+	}
+}
@@ -0,0 +1,81 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	s := New()
+	s.MaxBackoff = 10 * time.Minute
+	job := Job{Name: "metar", Interval: time.Minute}
+	now := time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 10 * time.Minute},
+	}
+
+	for _, tc := range cases {
+		if actual := s.next(job, tc.failures, now).Sub(now); actual != tc.expected {
+			t.Fatalf("%d failures: expected %s got %s", tc.failures, tc.expected, actual)
+		}
+	}
+}
+
+func TestAtHours(t *testing.T) {
+	next := AtHours(30, 3, 9, 15, 21)
+
+	cases := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 25, 3, 30, 0, 0, time.UTC)},
+		{time.Date(2025, 6, 25, 9, 30, 0, 0, time.UTC), time.Date(2025, 6, 25, 15, 30, 0, 0, time.UTC)},
+		{time.Date(2025, 6, 25, 22, 0, 0, 0, time.UTC), time.Date(2025, 6, 26, 3, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		if actual := next(tc.now); !actual.Equal(tc.expected) {
+			t.Fatalf("%s: expected %s got %s", tc.now, tc.expected, actual)
+		}
+	}
+}
+
+func TestSchedulerStatus(t *testing.T) {
+	s := New()
+	ran := make(chan struct{}, 1)
+	s.Add(Job{
+		Name:     "failing",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			ran <- struct{}{}
+			return errors.New("upstream timed out")
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	<-ran
+
+	for range 100 {
+		status := s.Status()[0]
+		if status.Failures == 1 {
+			if status.LastError != "upstream timed out" || status.NextRun.IsZero() {
+				t.Fatalf("unexpected status %+v", status)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expected job failure to be recorded")
+}
@@ -1,11 +1,13 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"scuffed-v2/internal/util"
 	"strings"
+	"time"
 )
 
 const (
@@ -19,6 +21,24 @@ const (
 	}`
 )
 
+const CamecoSource = "cameco"
+
+func init() {
+	Register(&SiteSource{
+		SourceName:  CamecoSource,
+		Sites:       CamecoSites,
+		Provides:    []Capability{CapMetar},
+		Pull:        GetCamecoWeatherReport,
+		MaxInFlight: 2,
+	})
+}
+
+// CamecoSites are the mine site aerodromes Cameco publishes weather for
+var CamecoSites = []string{
+	"CJW7", // Cigar Lake
+	"CKQ8", // McArthur River
+}
+
 type CamecoResponse struct {
 	D struct {
 		Type             string        `json:"__type"`
@@ -44,12 +64,12 @@ type CamecoResponse struct {
 }
 
 // GetCamecoWeatherReport returns the metar readouts for the specified site
-func GetCamecoWeatherReport(site string) (*WeatherReport, error) {
+func GetCamecoWeatherReport(ctx context.Context, site string) (*WeatherReport, error) {
 	var body CamecoResponse
 
 	var camecoRequestBody = strings.NewReader(fmt.Sprintf(CamecoRequestBody, site))
 
-	req, err := http.NewRequest("POST", "https://smartweb.axys-aps.com/svc/WebDataService.svc/WebData/GetWebDataResponse", camecoRequestBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://smartweb.axys-aps.com/svc/WebDataService.svc/WebData/GetWebDataResponse", camecoRequestBody)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +77,7 @@ func GetCamecoWeatherReport(site string) (*WeatherReport, error) {
 	req.Header.Set("Keep-Alive", "timeout=3")
 	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
 
-	err = util.RequestAndParse(req, &body)
+	err = util.RequestAndParse(ctx, req, &body)
 	if err != nil {
 		return nil, err
 	}
@@ -88,9 +108,10 @@ func ProcessCamecoMetarResponse(mr CamecoResponse, site string) (*WeatherReport,
 				slog.Int("expected", 2),
 				slog.Int("actual", len(mr.D.Rows)),
 			)
-			return &res, nil
+			break
 		}
 	}
 
+	res.decodeMetars(time.Now())
 	return &res, nil
 }
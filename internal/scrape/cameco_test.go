@@ -1,6 +1,7 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -8,7 +9,7 @@ import (
 func TestGetCamecoWeatherReport(t *testing.T) {
 	// takes 18 seconds btw
 	// ?no it doesnt?
-	report, err := GetCamecoWeatherReport("CJW7")
+	report, err := GetCamecoWeatherReport(context.Background(), "CJW7")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,84 +1,119 @@
 package scrape
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log/slog"
 	"slices"
 )
 
-var Navcansites = []string{
-	"CYXE",
-	"CYVT",
-	"CYLJ",
-	"CYSF",
-	"CYVC",
-	"CYKJ",
-	"CYPA",
-	"CYFO",
-	"CYQW",
-	"CYQR",
-	"CYMM",
-	"CYSM",
-	"CYPY",
-	"CYQD",
-	"CYLL",
-	"CYYN",
-	"CYXH",
-	"CYTH",
-	"CYQV",
-	"CYOD",
-	"CYYL",
+// pullResult is the outcome of fetching some sites from a single source
+type pullResult struct {
+	reports []*WeatherReport
+	errs    SiteErrors
 }
 
-type RequestCoordinator struct {
-	SupportedSites   []string
-	PullFunc         func(string) (*WeatherReport, error)
-	BatchFunc        func([]string) ([]*WeatherReport, error)
-	SupportsBatching bool
+// sourceSites pairs a source with the requested sites it supports
+type sourceSites struct {
+	source Source
+	sites  []string
 }
 
-func DoTheThing(c []RequestCoordinator, s []string) ([]*WeatherReport, error) {
-	remaining := slices.Clone(s) // work with copy
-	var res []*WeatherReport
-	// batch what we can
-	for _, coordinator := range c {
-		if !coordinator.SupportsBatching {
-			continue
+// DoTheThing pulls the reports for sites s from every source that supports them, fetching from each source
+// concurrently until ctx is done. Reports for a site from more than one source are merged with MergeReports,
+// preferring sources in the order they are given. Every report that could be pulled is returned, along with
+// SiteErrors for the sites (or sources) that couldn't
+func DoTheThing(ctx context.Context, sources []Source, s []string) ([]*WeatherReport, error) {
+	var errs SiteErrors
+	for _, site := range s {
+		if !slices.ContainsFunc(sources, func(source Source) bool {
+			return slices.Contains(source.SupportedSites(), site)
+		}) {
+			errs = append(errs, &SiteError{Site: site, Kind: ErrUnsupported, Message: "no source supports this site"})
 		}
+	}
 
-		var batchable []string
+	var work []sourceSites
+	for _, source := range sources {
+		var sites []string
 		for _, site := range s {
-			if slices.Contains(coordinator.SupportedSites, site) {
-				batchable = append(batchable, site)
-				slices.DeleteFunc(remaining, func(s string) bool {
-					return s == site
-				})
+			if slices.Contains(source.SupportedSites(), site) && !slices.Contains(sites, site) {
+				sites = append(sites, site)
 			}
 		}
+		if len(sites) > 0 {
+			work = append(work, sourceSites{source, sites})
+		}
+	}
 
-		if coordinator.SupportsBatching {
-			fmt.Println("batching", batchable)
-			results, err := coordinator.BatchFunc(batchable)
-			if err != nil {
-				slog.Error("Unable to handle batch", slog.String("err", err.Error()), slog.Any("batchable", batchable))
-				panic(err)
-			}
-			res = append(res, results...)
+	bySite := make(map[string][]*WeatherReport)
+	for result := range Parallelize(ctx, work, len(work), fetch) {
+		for _, report := range result.reports {
+			bySite[report.Airport] = append(bySite[report.Airport], report)
 		}
+		errs = append(errs, result.errs...)
 	}
 
-	// do the rest as singles
-	for _, site := range remaining {
-		for _, coordinator := range c {
-			if slices.Contains(coordinator.SupportedSites, site) {
-				out, err := coordinator.PullFunc(site)
-				if err != nil {
-					panic(err)
-				}
-				res = append(res, out)
-			}
+	order := make([]string, 0, len(sources))
+	for _, source := range sources {
+		order = append(order, source.Name())
+	}
+
+	var res []*WeatherReport
+	for _, site := range s {
+		if reports, ok := bySite[site]; ok {
+			res = append(res, MergeReports(site, reports, order))
+			delete(bySite, site)
 		}
 	}
 
+	if len(errs) > 0 {
+		return res, errs
+	}
 	return res, nil
 }
+
+// fetch calls Fetch on a single source, making sure every requested site ends up with a report or an error
+func fetch(ctx context.Context, w sourceSites) pullResult {
+	name := w.source.Name()
+	slog.Debug("Fetching from source", slog.String("source", name), slog.Any("sites", w.sites))
+
+	reports, err := withContext(ctx, func() ([]*WeatherReport, error) {
+		return w.source.Fetch(ctx, w.sites)
+	})
+
+	var res pullResult
+	var siteErrs SiteErrors
+	switch {
+	case errors.As(err, &siteErrs):
+		for _, siteErr := range siteErrs {
+			if siteErr.Source == "" {
+				siteErr.Source = name
+			}
+		}
+		res.errs = siteErrs
+	case err != nil:
+		slog.Error("Unable to fetch from source", slog.String("source", name), slog.String("err", err.Error()), slog.Any("sites", w.sites))
+		for _, site := range w.sites {
+			res.errs = append(res.errs, NewSiteError(site, name, err))
+		}
+	}
+
+	for _, report := range reports {
+		if report != nil {
+			report.Source = name
+			res.reports = append(res.reports, report)
+		}
+	}
+
+	// a source can succeed without including every site
+	for _, site := range w.sites {
+		hasReport := slices.ContainsFunc(res.reports, func(report *WeatherReport) bool { return report.Airport == site })
+		hasErr := slices.ContainsFunc(res.errs, func(siteErr *SiteError) bool { return siteErr.Site == site })
+		if !hasReport && !hasErr {
+			res.errs = append(res.errs, &SiteError{Site: site, Source: name, Kind: ErrNoData, Message: "no report returned"})
+		}
+	}
+
+	return res
+}
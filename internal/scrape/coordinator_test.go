@@ -1,28 +1,17 @@
 package scrape
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"maps"
-	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-var registry = []RequestCoordinator{
-	{
-		SupportedSites:   Navcansites,
-		BatchFunc:        GetNavCanWeatherReports,
-		SupportsBatching: true,
-	},
-	{
-		SupportedSites:   slices.Collect(maps.Keys(SiteNamesMap)),
-		PullFunc:         GetHighwaysWeatherReport,
-		SupportsBatching: false,
-	},
-}
-
 func TestDoTheThing(t *testing.T) {
-	fmt.Println(registry[1].SupportedSites)
-	out, err := DoTheThing(registry, []string{"CYXE", "CYYL", "CJY4"})
+	out, err := DoTheThing(context.Background(), Sources(), []string{"CYXE", "CYYL", "CJY4"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,3 +20,113 @@ func TestDoTheThing(t *testing.T) {
 		fmt.Println(rec)
 	}
 }
+
+func TestDoTheThingPartialResults(t *testing.T) {
+	sources := []Source{
+		&BatchSource{
+			SourceName: "batch",
+			Sites:      []string{"CYXE", "CYSF"},
+			Batch: func(ctx context.Context, sites []string) ([]*WeatherReport, error) {
+				return []*WeatherReport{{Airport: "CYXE"}}, nil
+			},
+		},
+		&SiteSource{
+			SourceName: "single",
+			Sites:      []string{"CJY4", "CZPO"},
+			Pull: func(ctx context.Context, site string) (*WeatherReport, error) {
+				if site == "CZPO" {
+					return nil, context.DeadlineExceeded
+				}
+				return &WeatherReport{Airport: site}, nil
+			},
+		},
+	}
+
+	out, err := DoTheThing(context.Background(), sources, []string{"CYXE", "CYSF", "CJY4", "CZPO", "KXXX"})
+	if len(out) != 2 {
+		t.Fatalf("expected reports for CYXE and CJY4 got %d reports", len(out))
+	}
+
+	var siteErrs SiteErrors
+	if !errors.As(err, &siteErrs) {
+		t.Fatalf("expected SiteErrors got %v", err)
+	}
+
+	expected := map[string]ErrorKind{"CYSF": ErrNoData, "CZPO": ErrTimeout, "KXXX": ErrUnsupported}
+	if len(siteErrs) != len(expected) {
+		t.Fatalf("expected %d errors got %v", len(expected), siteErrs)
+	}
+	for _, siteErr := range siteErrs {
+		if expected[siteErr.Site] != siteErr.Kind {
+			t.Fatalf("expected %s to be %q got %q", siteErr.Site, expected[siteErr.Site], siteErr.Kind)
+		}
+	}
+}
+
+func TestDoTheThingConcurrencyLimit(t *testing.T) {
+	var inFlight, maxSeen atomic.Int32
+	source := &SiteSource{
+		SourceName: "single",
+		Sites:      []string{"CJY4", "CZPO", "CJW4", "CJT4", "CYHB", "CJL4"},
+		Pull: func(ctx context.Context, site string) (*WeatherReport, error) {
+			current := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				seen := maxSeen.Load()
+				if current <= seen || maxSeen.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return &WeatherReport{Airport: site}, nil
+		},
+		MaxInFlight: 2,
+	}
+
+	// the limit holds across requests for the same source at once
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := DoTheThing(context.Background(), []Source{source}, source.Sites)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(out) != 6 {
+				t.Errorf("expected 6 reports got %d", len(out))
+			}
+		}()
+	}
+	wg.Wait()
+	if maxSeen.Load() != 2 {
+		t.Fatalf("expected 2 requests in flight at most, saw %d", maxSeen.Load())
+	}
+}
+
+func TestDoTheThingDeadline(t *testing.T) {
+	sources := []Source{
+		&SiteSource{
+			SourceName: "slow",
+			Sites:      []string{"CJY4"},
+			Pull: func(ctx context.Context, site string) (*WeatherReport, error) {
+				time.Sleep(time.Second)
+				return &WeatherReport{Airport: site}, nil
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := DoTheThing(ctx, sources, []string{"CJY4"})
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("expected DoTheThing to return at the deadline, took %s", time.Since(start))
+	}
+
+	var siteErrs SiteErrors
+	if !errors.As(err, &siteErrs) || len(siteErrs) != 1 || siteErrs[0].Kind != ErrTimeout {
+		t.Fatalf("expected a timeout error got %v", err)
+	}
+}
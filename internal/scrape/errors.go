@@ -0,0 +1,67 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+)
+
+type ErrorKind string
+
+const (
+	ErrTimeout     ErrorKind = "timeout"
+	ErrParse       ErrorKind = "parse"
+	ErrUpstream    ErrorKind = "upstream"
+	ErrNoData      ErrorKind = "no_data"
+	ErrUnsupported ErrorKind = "unsupported_site"
+)
+
+// A SiteError is why a single site couldn't be pulled from a source
+type SiteError struct {
+	Site    string    `json:"site"`
+	Source  string    `json:"source,omitempty"`
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+	Err     error     `json:"-"`
+}
+
+// NewSiteError classifies err as a timeout, parsing or general upstream failure
+func NewSiteError(site, source string, err error) *SiteError {
+	kind := ErrUpstream
+
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		kind = ErrTimeout
+	case errors.As(err, &syntaxErr) || errors.As(err, &typeErr):
+		kind = ErrParse
+	}
+
+	return &SiteError{Site: site, Source: source, Kind: kind, Message: err.Error(), Err: err}
+}
+
+func (e *SiteError) Error() string {
+	if e.Source == "" {
+		return e.Site + ": " + e.Message
+	}
+	return e.Source + " " + e.Site + ": " + e.Message
+}
+
+func (e *SiteError) Unwrap() error {
+	return e.Err
+}
+
+// SiteErrors is returned alongside partial results when only some sites fail
+type SiteErrors []*SiteError
+
+func (e SiteErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
@@ -1,13 +1,29 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/net/html"
 	"log/slog"
+	"maps"
 	"scuffed-v2/internal/util"
+	"slices"
 	"strings"
+	"time"
 )
 
+const HighwaysSource = "highways"
+
+func init() {
+	Register(&SiteSource{
+		SourceName:  HighwaysSource,
+		Sites:       slices.Sorted(maps.Keys(SiteNamesMap)),
+		Provides:    []Capability{CapMetar, CapCams},
+		Pull:        GetHighwaysWeatherReport,
+		MaxInFlight: 4,
+	})
+}
+
 var SiteNamesMap = map[string]string{
 	"CYBE": "uranium",
 	"CZFD": "fonddulac",
@@ -28,12 +44,12 @@ var SiteNamesMap = map[string]string{
 	"CYHB": "hudsonbay",
 }
 
-func GetHighwaysWeatherReport(site string) (*WeatherReport, error) {
+func GetHighwaysWeatherReport(ctx context.Context, site string) (*WeatherReport, error) {
 	siteName := SiteNamesMap[site]
 	slog.Info("highways", slog.String("siteName", siteName), slog.String("site", site))
 	var body string
 	url := fmt.Sprintf("http://highways.glmobile.com/%s", siteName)
-	err := util.GetAndParseString(url, &body)
+	err := util.GetAndParseString(ctx, url, &body)
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +67,7 @@ func ProcessHighwaysMetarResponse(document *html.Node, url, site string) (*Weath
 		Cams:    ExtractCamUrls(document, url),
 		Metar:   ExtractMetarReadOuts(document),
 	}
+	res.decodeMetars(time.Now())
 	return res, nil
 }
 
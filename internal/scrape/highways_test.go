@@ -1,6 +1,7 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/net/html"
 	"os"
@@ -9,7 +10,7 @@ import (
 )
 
 func TestGetHighwaysWeatherReport(t *testing.T) {
-	report, err := GetHighwaysWeatherReport("fonddulac")
+	report, err := GetHighwaysWeatherReport(context.Background(), "fonddulac")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -39,4 +40,7 @@ func TestProcessHighwaysMetarResponse(t *testing.T) {
 	if len(result.Cams) != expectedCamURLs {
 		t.Fatalf("Expected %d cams, got %d", expectedCamURLs, len(result.Cams))
 	}
+	if len(result.Observations) != expectedMetarCount {
+		t.Fatalf("Expected %d decoded metars, got %d", expectedMetarCount, len(result.Observations))
+	}
 }
@@ -0,0 +1,77 @@
+package scrape
+
+import (
+	"cmp"
+	"scuffed-v2/internal/metar"
+	"slices"
+)
+
+// SitePriority is the order sources are preferred in for sites served by more than one source. Sources that
+// aren't listed come after, in the order they were given
+var SitePriority = map[string][]string{
+	// NavCanada has the official METAR/TAF, highways adds the cams
+	"CYSF": {NavCanadaSource, HighwaysSource},
+	"CYVT": {NavCanadaSource, HighwaysSource},
+	"CYLJ": {NavCanadaSource, HighwaysSource},
+}
+
+// Fields of a WeatherReport that are tracked in WeatherReport.Sources
+const (
+	MetarField = "metar"
+	TafField   = "taf"
+	CamsField  = "cams"
+)
+
+// MergeReports combines the reports for site into one, taking the metar, taf and cams each from the most preferred
+// source that has them. Decoded fields follow the raw field they came from. Reports are never modified
+func MergeReports(site string, reports []*WeatherReport, order []string) *WeatherReport {
+	ranked := slices.Clone(reports)
+	slices.SortStableFunc(ranked, func(a, b *WeatherReport) int {
+		return cmp.Compare(priority(site, a.Source, order), priority(site, b.Source, order))
+	})
+
+	res := &WeatherReport{
+		Airport:        site,
+		FlightCategory: metar.Unknown,
+		Sources:        make(map[string]string),
+	}
+
+	if len(ranked) > 0 {
+		res.Source = ranked[0].Source
+	}
+
+	for _, report := range ranked {
+		if _, ok := res.Sources[MetarField]; !ok && len(report.Metar) > 0 {
+			res.Metar = report.Metar
+			res.Observations = report.Observations
+			res.FlightCategory = report.FlightCategory
+			res.Sources[MetarField] = report.Source
+		}
+		if _, ok := res.Sources[TafField]; !ok && len(report.Taf) > 0 {
+			res.Taf = report.Taf
+			res.Forecasts = report.Forecasts
+			res.ForecastCategories = report.ForecastCategories
+			res.Sources[TafField] = report.Source
+		}
+		if _, ok := res.Sources[CamsField]; !ok && len(report.Cams) > 0 {
+			res.Cams = report.Cams
+			res.Sources[CamsField] = report.Source
+		}
+	}
+
+	return res
+}
+
+// priority ranks source for site, lower is preferred
+func priority(site, source string, order []string) int {
+	preferred := SitePriority[site]
+	if i := slices.Index(preferred, source); i != -1 {
+		return i
+	}
+
+	i := slices.Index(order, source)
+	if i == -1 {
+		i = len(order)
+	}
+	return len(preferred) + i
+}
@@ -0,0 +1,44 @@
+package scrape
+
+import (
+	"scuffed-v2/internal/metar"
+	"testing"
+)
+
+func TestMergeReports(t *testing.T) {
+	highways := &WeatherReport{
+		Airport:        "CYSF",
+		Metar:          []string{"METAR CYSF 250100Z AUTO 19006KT 9SM CLR 23/06 A2980"},
+		Cams:           []string{"http://highways.glmobile.com/stonyrapids/cam1.jpg"},
+		FlightCategory: metar.VFR,
+		Source:         "highways",
+	}
+	navCanada := &WeatherReport{
+		Airport:        "CYSF",
+		Metar:          []string{"METAR CYSF 250100Z 19006KT 2SM BR OVC008 23/06 A2980"},
+		Taf:            []string{"TAF CYSF 241740Z 2418/2506 19006KT P6SM SKC"},
+		FlightCategory: metar.IFR,
+		Source:         "navcanada",
+	}
+
+	// highways is first in order, but SitePriority prefers navcanada for CYSF
+	merged := MergeReports("CYSF", []*WeatherReport{highways, navCanada}, []string{"highways", "navcanada"})
+
+	if merged.Metar[0] != navCanada.Metar[0] || merged.FlightCategory != metar.IFR {
+		t.Fatalf("expected the navcanada metar got %v (%s)", merged.Metar, merged.FlightCategory)
+	}
+	if len(merged.Cams) != 1 {
+		t.Fatalf("expected cams from highways got %v", merged.Cams)
+	}
+
+	expectedSources := map[string]string{MetarField: "navcanada", TafField: "navcanada", CamsField: "highways"}
+	for field, source := range expectedSources {
+		if merged.Sources[field] != source {
+			t.Fatalf("expected %s from %s got %q", field, source, merged.Sources[field])
+		}
+	}
+
+	if highways.Sources != nil || navCanada.Sources != nil {
+		t.Fatal("expected merging to leave the original reports untouched")
+	}
+}
@@ -2,6 +2,7 @@ package scrape
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -15,7 +16,25 @@ type MQTTReportLogTopicMessage struct {
 	History []string `json:"history"`
 }
 
-func GetMesotechWeatherReport(site string) (*WeatherReport, error) {
+const MesotechSource = "mesotech"
+
+func init() {
+	Register(&SiteSource{
+		SourceName: MesotechSource,
+		Sites:      MesotechSites,
+		Provides:   []Capability{CapMetar},
+		Pull:       GetMesotechWeatherReport,
+		// every connection uses the same MQTT client id, a second connection would kick off the first
+		MaxInFlight: 1,
+	})
+}
+
+// MesotechSites are the AWOS sites published on mqtt.awos.live
+var MesotechSites = []string{
+	"CET2", // Conklin (Leismer)
+}
+
+func GetMesotechWeatherReport(ctx context.Context, site string) (*WeatherReport, error) {
 	opts := MQTT.NewClientOptions().
 		AddBroker("wss://mqtt.awos.live:8083/").
 		SetTLSConfig(&tls.Config{InsecureSkipVerify: true}).
@@ -26,20 +45,22 @@ func GetMesotechWeatherReport(site string) (*WeatherReport, error) {
 
 	mqttClient := MQTT.NewClient(opts)
 
-	return ProcessMesotechMetarResponse(mqttClient, site)
+	return ProcessMesotechMetarResponse(ctx, mqttClient, site)
 }
 
-func ProcessMesotechMetarResponse(client MQTT.Client, site string) (*WeatherReport, error) {
+func ProcessMesotechMetarResponse(ctx context.Context, client MQTT.Client, site string) (*WeatherReport, error) {
 	res := WeatherReport{
 		Airport: site,
 	}
 
-	token := client.Connect()
-	token.Wait()
-	if token.Error() != nil {
-		return nil, token.Error()
+	err := waitToken(ctx, client.Connect())
+	if err != nil {
+		return nil, err
 	}
+	defer client.Disconnect(250)
 
+	// the report log is delivered on the client's own goroutine once subscribed
+	history := make(chan []string, 1)
 	topic := fmt.Sprintf("AWA/%s/Archives/ReportLog", site)
 	subToken := client.Subscribe(topic, 0, func(client MQTT.Client, msg MQTT.Message) {
 		var dest *MQTTReportLogTopicMessage
@@ -50,16 +71,34 @@ func ProcessMesotechMetarResponse(client MQTT.Client, site string) (*WeatherRepo
 			return
 		}
 
-		res.Metar = dest.History[:int(math.Min(float64(len(dest.History)), 5))]
+		select {
+		case history <- dest.History[:int(math.Min(float64(len(dest.History)), 5))]:
+		default:
+		}
 	})
 
-	subToken.Wait()
-	if subToken.Error() != nil {
-		return nil, subToken.Error()
+	err = waitToken(ctx, subToken)
+	if err != nil {
+		return nil, err
 	}
+	defer client.Unsubscribe(topic)
 
-	client.Unsubscribe(topic)
-	client.Disconnect(250)
+	select {
+	case res.Metar = <-history:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
+	res.decodeMetars(time.Now())
 	return &res, nil
 }
+
+// waitToken waits for an MQTT operation to finish or ctx to be done, whichever comes first
+func waitToken(ctx context.Context, token MQTT.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,14 +1,75 @@
 package scrape
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"testing"
+	"time"
 )
 
 func TestGetMesotechWeatherReport(t *testing.T) {
-	report, err := GetMesotechWeatherReport("CET2")
+	report, err := GetMesotechWeatherReport(context.Background(), "CET2")
 	if err != nil {
 		t.Fatal(err)
 	}
 	fmt.Println(report)
 }
+
+type fakeToken struct{ done chan struct{} }
+
+func newFakeToken() fakeToken {
+	done := make(chan struct{})
+	close(done)
+	return fakeToken{done}
+}
+
+func (f fakeToken) Wait() bool                     { return true }
+func (f fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (f fakeToken) Done() <-chan struct{}          { return f.done }
+func (f fakeToken) Error() error                   { return nil }
+
+type fakeMessage struct {
+	MQTT.Message
+	payload []byte
+}
+
+func (f fakeMessage) Payload() []byte { return f.payload }
+
+// fakeMQTTClient delivers payload on its own goroutine after subscribing, like the real client
+type fakeMQTTClient struct {
+	MQTT.Client
+	payload []byte
+}
+
+func (f *fakeMQTTClient) Connect() MQTT.Token                     { return newFakeToken() }
+func (f *fakeMQTTClient) Disconnect(uint)                         {}
+func (f *fakeMQTTClient) Unsubscribe(topics ...string) MQTT.Token { return newFakeToken() }
+func (f *fakeMQTTClient) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		callback(f, fakeMessage{payload: f.payload})
+	}()
+	return newFakeToken()
+}
+
+func TestProcessMesotechMetarResponse(t *testing.T) {
+	metar := fmt.Sprintf("METAR CET2 %sZ AUTO 27010KT 9SM CLR 18/05 A2992 RMK AO1", time.Now().UTC().Format("021504"))
+	client := &fakeMQTTClient{payload: []byte(`{"history": ["` + metar + `"]}`)}
+
+	report, err := ProcessMesotechMetarResponse(context.Background(), client, "CET2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Metar) != 1 || len(report.Observations) != 1 {
+		t.Fatalf("expected the METAR delivered after subscribing to be decoded got %+v", report)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = ProcessMesotechMetarResponse(ctx, &fakeMQTTClient{payload: []byte(`{"history": []}`)}, "CET2")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline waiting for the report log got %v", err)
+	}
+}
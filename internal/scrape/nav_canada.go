@@ -1,11 +1,13 @@
 package scrape
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"maps"
-	"net/http"
+	"math"
 	"scuffed-v2/internal/util"
 	"slices"
 	"strconv"
@@ -14,15 +16,48 @@ import (
 )
 
 const (
-	NavCanBaseApiUrl = "https://plan.navcanada.ca/weather/api/alpha/?"
+	NavCanadaSource = "navcanada"
 
-	CloudForecast      = "GFA/CLDWX/GFACN32/"
-	TurbulenceForecast = "GFA/TURBC/GFACN32/"
+	NavCanBaseApiUrl = "https://plan.navcanada.ca/weather/api/alpha/?"
+	NavCanImageUrl   = "https://plan.navcanada.ca/weather/images/%s.image"
 
 	NavCanadaTimeFormat    = "2006-01-02T15:04:05"
 	NavCanadaTimeFormatAlt = "2006-01-02T15:04:05+00:00"
 )
 
+func init() {
+	Register(&BatchSource{
+		SourceName: NavCanadaSource,
+		Sites:      Navcansites,
+		Provides:   []Capability{CapMetar, CapTaf, CapWinds, CapGFA, CapAdvisories, CapNotams, CapPireps},
+		Batch:      GetNavCanWeatherReports,
+	})
+}
+
+var Navcansites = []string{
+	"CYXE",
+	"CYVT",
+	"CYLJ",
+	"CYSF",
+	"CYVC",
+	"CYKJ",
+	"CYPA",
+	"CYFO",
+	"CYQW",
+	"CYQR",
+	"CYMM",
+	"CYSM",
+	"CYPY",
+	"CYQD",
+	"CYLL",
+	"CYYN",
+	"CYXH",
+	"CYTH",
+	"CYQV",
+	"CYOD",
+	"CYYL",
+}
+
 // NavCanadaResponse is a general structure returned from all NavCanada endpoints often
 // with each Data Text field containing escaped json
 type NavCanadaResponse[PositionType any] struct {
@@ -52,32 +87,123 @@ type Position struct {
 	RadialDistance any `json:"radialDistance"`
 }
 
+// Positions are where a datum applies to for each requested site, NavCanada sends a single Position rather than a list
+// when only one site is requested
+type Positions []Position
+
+func (p *Positions) UnmarshalJSON(data []byte) error {
+	var list []Position
+	if err := json.Unmarshal(data, &list); err == nil {
+		*p = list
+		return nil
+	}
+
+	var single Position
+	err := json.Unmarshal(data, &single)
+	if err != nil {
+		return err
+	}
+	*p = Positions{single}
+	return nil
+}
+
+// Sites are the requested sites in p
+func (p Positions) Sites() []string {
+	var res []string
+	for _, position := range p {
+		if site, ok := position.PointReference.(string); ok && site != "" && !slices.Contains(res, site) {
+			res = append(res, site)
+		}
+	}
+	return res
+}
+
 // GFAText represents the Text section of a NavCanadaResponse GFA query
 type GFAText struct {
-	Product      string `json:"product"`
-	SubProduct   string `json:"sub_product"`
-	Geography    string `json:"geography"`
-	SubGeography string `json:"sub_geography"`
-	FrameLists   []struct {
-		Id     int    `json:"id"`
-		Sv     string `json:"sv"`
-		Ev     string `json:"ev"`
-		Frames []struct {
-			Id            int    `json:"id"`
-			StartValidity string `json:"sv"`
-			EndValidity   string `json:"ev"`
-			Images        []struct {
-				Id      int    `json:"id"`
-				Created string `json:"created"`
-			} `json:"images"`
-		} `json:"frames"`
-	} `json:"frame_lists"`
-}
-
-// GFA is the desired data extracted from a NavCanadaResponse
+	Product      string         `json:"product"`
+	SubProduct   string         `json:"sub_product"`
+	Geography    string         `json:"geography"`
+	SubGeography string         `json:"sub_geography"`
+	FrameLists   []GFAFrameList `json:"frame_lists"`
+}
+
+// GFAFrameList is a single issuance of a GFA chart
+type GFAFrameList struct {
+	Id     int    `json:"id"`
+	Sv     string `json:"sv"`
+	Ev     string `json:"ev"`
+	Frames []struct {
+		Id            int    `json:"id"`
+		StartValidity string `json:"sv"`
+		EndValidity   string `json:"ev"`
+		Images        []struct {
+			Id      int    `json:"id"`
+			Created string `json:"created"`
+		} `json:"images"`
+	} `json:"frames"`
+}
+
+// GFARegions are each GFA domain and a site in it, GFAs are requested by site
+var GFARegions = map[string]string{
+	"GFACN31": "CYVR", // Pacific
+	"GFACN32": "CYXE", // Prairies
+	"GFACN33": "CYOW", // Ontario and Quebec
+	"GFACN34": "CYHZ", // Atlantic
+	"GFACN35": "CYZF", // Yukon and Northwest Territories
+	"GFACN36": "CYFB", // Nunavut
+	"GFACN37": "CYRB", // Arctic
+}
+
+// GFA is the desired data extracted from a NavCanadaResponse for a single region
 type GFA struct {
+	Region string `json:"region"` // e.g. GFACN32, empty if the location couldn't be recognized
+	// Sites are the requested sites the region covers
+	Sites                   []string      `json:"sites,omitempty"`
 	CloudsWeather           []GFAMetadata `json:"clouds_weather"`
 	IcingTurbulenceFreezing []GFAMetadata `json:"icing_turbulence_freezing"`
+	// Previous is the issuance before CloudsWeather and IcingTurbulenceFreezing's, nil if it wasn't returned
+	Previous *GFAIssuance `json:"previous,omitempty"`
+	// Other holds frames for any charts other than the two above, by their location
+	Other map[string][]GFAMetadata `json:"other,omitempty"`
+}
+
+// GFAIssuance is the frames of both charts from a single issuance
+type GFAIssuance struct {
+	CloudsWeather           []GFAMetadata `json:"clouds_weather"`
+	IcingTurbulenceFreezing []GFAMetadata `json:"icing_turbulence_freezing"`
+}
+
+// GFAFrames is the frame of each chart valid at a time, nil if the issuance doesn't cover it
+type GFAFrames struct {
+	CloudsWeather           *GFAMetadata `json:"clouds_weather"`
+	IcingTurbulenceFreezing *GFAMetadata `json:"icing_turbulence_freezing"`
+}
+
+// At returns the frames of the latest and previous issuance valid at a time
+func (g *GFA) At(at time.Time) (GFAFrames, GFAFrames) {
+	latest := GFAIssuance{CloudsWeather: g.CloudsWeather, IcingTurbulenceFreezing: g.IcingTurbulenceFreezing}.At(at)
+	if g.Previous == nil {
+		return latest, GFAFrames{}
+	}
+	return latest, g.Previous.At(at)
+}
+
+// At returns the frames of the issuance valid at a time
+func (i GFAIssuance) At(at time.Time) GFAFrames {
+	return GFAFrames{
+		CloudsWeather:           FrameAt(i.CloudsWeather, at),
+		IcingTurbulenceFreezing: FrameAt(i.IcingTurbulenceFreezing, at),
+	}
+}
+
+// FrameAt returns the frame whose validity contains at, nil if there isn't one
+func FrameAt(frames []GFAMetadata, at time.Time) *GFAMetadata {
+	for i, frame := range frames {
+		if !at.Before(frame.StartValidity) && at.Before(frame.EndValidity) {
+			return &frames[i]
+		}
+	}
+	return nil
 }
 
 // testString produces a string to use in testing
@@ -98,7 +224,11 @@ func (g *GFA) testString() string {
 type GFAMetadata struct {
 	StartValidity time.Time `json:"start_validity"`
 	EndValidity   time.Time `json:"end_validity"`
-	Id            string    `json:"id"` // the Id  the image used in creating the URL (TODO: maybe do server-side?
+	Id            string    `json:"id"` // the Id of the image, see GFAImageURL
+	// Issued is when the image was created
+	Issued time.Time `json:"issued"`
+	// URL is where the image is served from by us, it is filled in by the api
+	URL string `json:"url,omitempty"`
 }
 
 // testString produces a string to use in testing
@@ -108,68 +238,140 @@ func (g *GFAMetadata) testString() string {
 		" " + g.Id + "]"
 }
 
-// GetGFAImageIds sends a request to NavCanada's severs synchronously to get GFA (Graphic Area Forecast) data
-func GetGFAImageIds() (GFA, error) {
-	var body NavCanadaResponse[Position]
+// GetGFAImageIds sends a request to NavCanada's severs synchronously to get the GFA (Graphic Area Forecast) data for
+// every region covering sites
+func GetGFAImageIds(ctx context.Context, sites ...string) ([]GFA, error) {
+	var body NavCanadaResponse[Positions]
 
 	url := NewUrlBuilder().
-		Sites("CYXE").
+		Sites(sites...).
 		Images(GfaTurbulence, GfaClouds).
 		Build()
 
-	err := util.GetAndParseJson(url, &body)
+	err := util.GetAndParseJson(ctx, url, &body)
 	if err != nil {
-		return GFA{}, err
+		return nil, err
 	}
 
 	return ProcessGFAResponse(body)
+}
+
+// GFAImageURL is NavCanada's URL for the GFA image with id
+func GFAImageURL(id string) string {
+	return fmt.Sprintf(NavCanImageUrl, id)
+}
 
+// GetGFAImage downloads the GFA image with id
+func GetGFAImage(ctx context.Context, id string) ([]byte, error) {
+	return util.GetBytes(ctx, GFAImageURL(id))
 }
 
-// ProcessGFAResponse extracts GFA data contained in gfaRes's NavCanadaResponse's Data.Text field
-func ProcessGFAResponse(gr NavCanadaResponse[Position]) (GFA, error) {
-	var res GFA
+// ProcessGFAResponse extracts GFA data contained in gfaRes's NavCanadaResponse's Data.Text field, grouped by region in
+// the order regions were first seen. Charts at locations that aren't recognized are kept in Other
+func ProcessGFAResponse(gr NavCanadaResponse[Positions]) ([]GFA, error) {
+	var res []*GFA
 
 	for _, datum := range gr.Data {
-		gfaMeta, err := ExtractGFAMeta(datum.Text)
+		issuances, err := ExtractGFAIssuances(datum.Text)
 		if err != nil {
-			return GFA{}, err
+			return nil, err
+		}
+		gfaMeta := issuances[len(issuances)-1]
+		var previous []GFAMetadata
+		if len(issuances) > 1 {
+			previous = issuances[len(issuances)-2]
 		}
 
-		switch datum.Location {
-		case CloudForecast:
-			res.CloudsWeather = append(res.CloudsWeather, gfaMeta...)
-		case TurbulenceForecast:
-			res.IcingTurbulenceFreezing = append(res.IcingTurbulenceFreezing, gfaMeta...)
+		chart, region := parseGFALocation(datum.Location)
+		i := slices.IndexFunc(res, func(gfa *GFA) bool { return gfa.Region == region })
+		if i < 0 {
+			res = append(res, &GFA{Region: region})
+			i = len(res) - 1
+		}
+		gfa := res[i]
+
+		for _, site := range datum.Positions.Sites() {
+			if !slices.Contains(gfa.Sites, site) {
+				gfa.Sites = append(gfa.Sites, site)
+			}
+		}
+
+		if previous != nil && (chart == GfaClouds || chart == GfaTurbulence) && gfa.Previous == nil {
+			gfa.Previous = &GFAIssuance{}
+		}
+
+		switch chart {
+		case GfaClouds:
+			gfa.CloudsWeather = append(gfa.CloudsWeather, gfaMeta...)
+			if previous != nil {
+				gfa.Previous.CloudsWeather = append(gfa.Previous.CloudsWeather, previous...)
+			}
+		case GfaTurbulence:
+			gfa.IcingTurbulenceFreezing = append(gfa.IcingTurbulenceFreezing, gfaMeta...)
+			if previous != nil {
+				gfa.Previous.IcingTurbulenceFreezing = append(gfa.Previous.IcingTurbulenceFreezing, previous...)
+			}
 		default:
-			return GFA{}, fmt.Errorf("unknown location: %s", datum.Location)
+			slog.Info("Unknown GFA location", slog.String("location", datum.Location))
+			if gfa.Other == nil {
+				gfa.Other = make(map[string][]GFAMetadata)
+			}
+			gfa.Other[datum.Location] = append(gfa.Other[datum.Location], gfaMeta...)
 		}
 	}
-	return res, nil
+
+	gfas := make([]GFA, 0, len(res))
+	for _, gfa := range res {
+		gfas = append(gfas, *gfa)
+	}
+	return gfas, nil
+}
+
+// parseGFALocation splits a location e.g. "GFA/CLDWX/GFACN32/" into its chart and region
+func parseGFALocation(location string) (ImageType, string) {
+	parts := strings.Split(strings.Trim(location, "/"), "/")
+	if len(parts) != 3 || parts[0] != "GFA" {
+		return "", ""
+	}
+	return ImageType(parts[0] + "/" + parts[1]), parts[2]
 }
 
 // ExtractGFAMeta extracts each frames data from the last FramesList from GFAText into GFAMetadata
 func ExtractGFAMeta(text string) ([]GFAMetadata, error) {
+	issuances, err := ExtractGFAIssuances(text)
+	if err != nil {
+		return nil, err
+	}
+	return issuances[len(issuances)-1], nil
+}
+
+// ExtractGFAIssuances extracts each frames data from every FramesList in GFAText, the oldest issuance first with its
+// frames in order of validity
+func ExtractGFAIssuances(text string) ([][]GFAMetadata, error) {
 	var gfaText GFAText
-	var records []GFAMetadata
 	err := json.NewDecoder(strings.NewReader(text)).Decode(&gfaText)
 	if err != nil {
 		return nil, err
 	}
 
-	hasFrames := len(gfaText.FrameLists) >= 0
-	if !hasFrames {
+	if len(gfaText.FrameLists) == 0 {
 		return nil, fmt.Errorf("no frames found")
 	}
 
-	lastFrameIdx := len(gfaText.FrameLists) - 1
-	lastFrames := gfaText.FrameLists[lastFrameIdx].Frames
+	// both are in NavCanadaTimeFormat so compare in time order as strings
+	frameLists := slices.Clone(gfaText.FrameLists)
+	slices.SortStableFunc(frameLists, func(a, b GFAFrameList) int { return strings.Compare(a.Sv, b.Sv) })
 
-	for _, frame := range lastFrames {
-		if len(frame.Images) > 0 {
-			meta := GFAMetadata{}
+	var res [][]GFAMetadata
+	for _, frameList := range frameLists {
+		var records []GFAMetadata
+		for _, frame := range frameList.Frames {
+			if len(frame.Images) == 0 {
+				continue
+			}
+			image := frame.Images[len(frame.Images)-1]
 
-			meta.Id = strconv.Itoa(frame.Images[len(frame.Images)-1].Id)
+			meta := GFAMetadata{Id: strconv.Itoa(image.Id)}
 
 			meta.EndValidity, err = time.Parse(NavCanadaTimeFormat, frame.EndValidity)
 			if err != nil {
@@ -181,15 +383,24 @@ func ExtractGFAMeta(text string) ([]GFAMetadata, error) {
 				return nil, err
 			}
 
+			// fractional seconds are accepted even though the format doesn't have them
+			meta.Issued, err = time.Parse(NavCanadaTimeFormat, image.Created)
+			if err != nil {
+				return nil, err
+			}
+
 			records = append(records, meta)
 		}
+
+		slices.SortStableFunc(records, func(a, b GFAMetadata) int { return a.StartValidity.Compare(b.StartValidity) })
+		res = append(res, records)
 	}
 
-	return records, nil
+	return res, nil
 }
 
 // GetNavCanWeatherReports returns the metar and taf readouts for the specified sites
-func GetNavCanWeatherReports(sites []string) ([]*WeatherReport, error) {
+func GetNavCanWeatherReports(ctx context.Context, sites []string) ([]*WeatherReport, error) {
 	var body NavCanadaResponse[any]
 
 	url := NewUrlBuilder().
@@ -198,11 +409,7 @@ func GetNavCanWeatherReports(sites []string) ([]*WeatherReport, error) {
 		Alpha(Metar, Taf).
 		Build()
 
-	request, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
-	err = util.RequestAndParse(request, &body)
+	err := util.GetAndParseJson(ctx, url, &body)
 	if err != nil {
 		return nil, err
 	}
@@ -230,6 +437,12 @@ func ProcessMETARResponse(mr NavCanadaResponse[any]) (map[string]*WeatherReport,
 		}
 	}
 
+	now := time.Now()
+	for _, report := range res {
+		report.decodeMetars(now)
+		report.decodeTafs(now)
+	}
+
 	return res, nil
 }
 
@@ -248,6 +461,8 @@ const (
 	Metar     Alpha = "metar"
 	Taf       Alpha = "taf"
 	Upperwind Alpha = "upperwind"
+	Notams    Alpha = "notam"
+	Pireps    Alpha = "pirep"
 )
 
 type NavCanUrl struct {
@@ -270,18 +485,29 @@ type AirportWinds struct {
 type Wind struct {
 	Data []ElevationValues `json:"elevation_values"`
 
+	Issued      time.Time `json:"issued"`
 	BasedOn     time.Time `json:"based_on"`
 	Valid       time.Time `json:"valid"`
 	ForUseStart time.Time `json:"for_use_start"`
 	ForUseEnd   time.Time `json:"for_use_end"`
 }
+
+// ElevationValues is the forecast at a single level, values that aren't forecast are nil
 type ElevationValues struct {
-	Elevation *float64 `json:"elevation"`
-	// Values is a *float64 because it can be empty
-	Values []*float64 `json:"values"`
+	Elevation   int  `json:"elevation"`   // feet ASL
+	Direction   *int `json:"direction"`   // degrees true
+	Speed       *int `json:"speed"`       // knots
+	Temperature *int `json:"temperature"` // celsius, never forecast at 3000ft
+	// LightAndVariable winds are under 5kt, Direction and Speed are 0
+	LightAndVariable bool `json:"light_and_variable,omitempty"`
 }
 
-func GetWinds(sites ...string) ([]AirportWinds, error) {
+// UpperWindStations are the stations upper winds are forecast for around the sites we serve
+var UpperWindStations = []string{
+	"CYXE", "CYQR", "CYPA", "CYYN", "CYMM", "CYEG", "CYYC", "CYQL", "CYPE", "CYQD", "CYTH", "CYYL", "CYWG", "CYSM", "CYZF",
+}
+
+func GetWinds(ctx context.Context, sites ...string) ([]AirportWinds, error) {
 	var body NavCanadaResponse[any]
 
 	url := NewUrlBuilder().
@@ -290,187 +516,220 @@ func GetWinds(sites ...string) ([]AirportWinds, error) {
 		Query("upperwind_choice", "both").
 		Build()
 
-	fmt.Println("url", url)
-
-	err := util.GetAndParseJson(url, &body)
+	err := util.GetAndParseJson(ctx, url, &body)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("err?", err)
-
 	return ProcessWindsResponse(body)
 }
 
-type WindsText struct {
-	Numbers []int
-	Strings []string
-	Arrays  [][]*float64
-	Times   []time.Time
+// UpperWindRecord is a single upper wind forecast (FB) for a station, NavCanada sends these as a positional array
+type UpperWindRecord struct {
+	Station     string // from the record's location, it isn't part of the array
+	Bulletin    string // e.g. FBCN35
+	Office      string // issuing office e.g. KWNO
+	Issued      time.Time
+	BasedOn     time.Time
+	Valid       time.Time
+	ForUseStart time.Time
+	ForUseEnd   time.Time
+	Levels      []ElevationValues
 }
 
-// UnmarshalJSON overrides the default json parse function based on struct annotations as WindsText is
-// []any and cannot be accurately described via struct tags
-func (w *WindsText) UnmarshalJSON(data []byte) error {
-	if len(data) == 0 {
-		return fmt.Errorf("data is empty, nothing to unmarshal")
-	}
+// positions of each field in an upper wind record, 7 to 10 are always null
+const (
+	bulletinField = iota
+	officeField
+	issuedField
+	basedOnField
+	validField
+	forUseStartField
+	forUseEndField
+	levelsField = 11
+
+	upperWindFields = levelsField + 1
+)
 
-	var raw []any
-	if err := json.Unmarshal(data, &raw); err != nil {
+// MalformedRecordError is returned when an upper wind record doesn't have the expected shape
+type MalformedRecordError struct {
+	Field  int
+	Reason string
+}
+
+func (e *MalformedRecordError) Error() string {
+	return fmt.Sprintf("malformed upper wind record at field %d: %s", e.Field, e.Reason)
+}
+
+func (r *UpperWindRecord) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
 		return err
 	}
+	if len(fields) != upperWindFields {
+		return &MalformedRecordError{Field: len(fields), Reason: fmt.Sprintf("expected %d fields", upperWindFields)}
+	}
 
-	for i, entry := range raw {
-		// Returned data always has "null" for in 7/8/9/10 positions
-		if slices.Contains([]int{7, 8, 9, 10}, i) {
-			continue
+	strs := map[int]*string{bulletinField: &r.Bulletin, officeField: &r.Office}
+	for i, dest := range strs {
+		err = json.Unmarshal(fields[i], dest)
+		if err != nil {
+			return &MalformedRecordError{Field: i, Reason: "expected a string"}
 		}
+	}
 
-		switch entry.(type) {
-		case string:
-			entryStr, ok := entry.(string)
-			if !ok {
-				return fmt.Errorf("entry is not a string")
-			}
-			timestamp, err := time.Parse(NavCanadaTimeFormatAlt, entryStr)
-			if err == nil {
-				w.Times = append(w.Times, timestamp.UTC())
-			} else {
-				w.Strings = append(w.Strings, entryStr)
-			}
-		case float64:
-			entryFloat, ok := entry.(float64)
-			if !ok {
-				return fmt.Errorf("cannot unmarshal float64")
-			}
-			w.Numbers = append(w.Numbers, int(entryFloat))
-		case int:
-			entryInt, ok := entry.(int)
-			if !ok {
-				return fmt.Errorf("cannot unmarshal int")
-			}
-			w.Numbers = append(w.Numbers, entryInt)
-		case []interface{}:
-			// winds data in [][]int
-			windsArr, ok := entry.([]interface{})
-			if !ok {
-				return fmt.Errorf("windsArray is not []interface{}")
-			}
-			for _, windsArray := range windsArr {
-				var parsedWindsValues []*float64
-				windsSubArray, ok := windsArray.([]interface{})
-				if !ok {
-					return fmt.Errorf("windsSubArray is not []interface{}")
-				}
-				for _, windArray := range windsSubArray {
-					windsSubArrayFloat, ok := windArray.(float64)
-					if !ok {
-						// set as null, probably is
-						parsedWindsValues = append(parsedWindsValues, nil)
-						continue
-					}
-					parsedWindsValues = append(parsedWindsValues, &windsSubArrayFloat)
-				}
-				w.Arrays = append(w.Arrays, parsedWindsValues)
-			}
-		default:
-			fmt.Printf("unknown type %T at %d\n", entry, i)
+	times := map[int]*time.Time{
+		issuedField:      &r.Issued,
+		basedOnField:     &r.BasedOn,
+		validField:       &r.Valid,
+		forUseStartField: &r.ForUseStart,
+		forUseEndField:   &r.ForUseEnd,
+	}
+	for i, dest := range times {
+		var raw string
+		err = json.Unmarshal(fields[i], &raw)
+		if err != nil {
+			return &MalformedRecordError{Field: i, Reason: "expected a time"}
+		}
+		t, err := time.Parse(NavCanadaTimeFormatAlt, raw)
+		if err != nil {
+			return &MalformedRecordError{Field: i, Reason: fmt.Sprintf("invalid time %q", raw)}
+		}
+		*dest = t.UTC()
+	}
+
+	var levels [][]*float64
+	err = json.Unmarshal(fields[levelsField], &levels)
+	if err != nil {
+		return &MalformedRecordError{Field: levelsField, Reason: "expected an array of levels"}
+	}
+
+	r.Levels = nil
+	for _, values := range levels {
+		level, err := decodeLevel(values)
+		if err != nil {
+			return &MalformedRecordError{Field: levelsField, Reason: err.Error()}
 		}
+		r.Levels = append(r.Levels, level)
 	}
+	slices.SortFunc(r.Levels, func(a, b ElevationValues) int { return a.Elevation - b.Elevation })
 
 	return nil
 }
 
 const (
-	expectedWindsCount = 5 // Elevation, <3x values>, 0
+	expectedWindsCount = 5 // Elevation, direction, speed, temperature, 0
 	elevationIndex     = 0
-	lowThreshold       = 18_000.0
+	directionIndex     = 1
+	speedIndex         = 2
+	temperatureIndex   = 3
+	lowThreshold       = 18_000
+
+	// lightAndVariable is the direction given for winds under 5kt (9900 in the FB text)
+	lightAndVariable = 990
+	// over100Offset is added to the direction of winds 100kt or more, the speed is given less 100kt
+	over100Offset = 500
 )
 
+// decodeLevel decodes a single level of [elevation, direction, speed, temperature, 0]
+func decodeLevel(values []*float64) (ElevationValues, error) {
+	if len(values) != expectedWindsCount {
+		return ElevationValues{}, fmt.Errorf("expected %d values in level got %d", expectedWindsCount, len(values))
+	}
+	if values[elevationIndex] == nil {
+		return ElevationValues{}, fmt.Errorf("level is missing its elevation")
+	}
+
+	level := ElevationValues{
+		Elevation:   int(*values[elevationIndex]),
+		Direction:   toInt(values[directionIndex]),
+		Speed:       toInt(values[speedIndex]),
+		Temperature: toInt(values[temperatureIndex]),
+	}
+	if level.Direction == nil || level.Speed == nil {
+		return level, nil
+	}
+
+	direction, speed := *level.Direction, *level.Speed
+	switch {
+	case direction == lightAndVariable:
+		level.LightAndVariable = true
+		direction, speed = 0, 0
+	case direction > 360+over100Offset || (direction > 360 && direction < over100Offset+10):
+		return ElevationValues{}, fmt.Errorf("invalid wind direction %d at %dft", direction, level.Elevation)
+	case direction > 360:
+		direction, speed = direction-over100Offset, speed+100
+	}
+	level.Direction, level.Speed = &direction, &speed
+
+	return level, nil
+}
+
+// ProcessWindsResponse groups each station's upper wind records into its low (18,000ft and below) and high
+// forecasts. Records that can't be decoded are skipped and returned as an error along with everything else
 func ProcessWindsResponse(wr NavCanadaResponse[any]) ([]AirportWinds, error) {
-	airportWinds := make(map[string]AirportWinds)
+	airportWinds := make(map[string]*AirportWinds)
+	var errs []error
 
-	// each wind record maps a wind state (full set of higher or lower and an associated timestamp) to an airport
 	for _, windRecord := range wr.Data {
-		currentAirport := windRecord.Location
-		// create if doesnt exist
-		_, ok := airportWinds[currentAirport]
-		if !ok {
-			airportWinds[currentAirport] = AirportWinds{AirportCode: currentAirport}
-		}
-
-		var wt WindsText
-		err := json.NewDecoder(strings.NewReader(windRecord.Text)).Decode(&wt)
+		var record UpperWindRecord
+		err := json.Unmarshal([]byte(windRecord.Text), &record)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("upper winds for %s: %w", windRecord.Location, err))
+			continue
 		}
+		record.Station = windRecord.Location
 
-		var (
-			highWinds Wind
-			lowWinds  Wind
-		)
-
-		//  first value is elevation, the rest are the speeds
-		for _, wind := range wt.Arrays {
-			if len(wind) != expectedWindsCount {
-				slog.Info("Expected winds count doesn't match actual",
-					slog.Int("expected", expectedWindsCount),
-					slog.Int("actual", len(wind)),
-					slog.Any("arr", wind),
-				)
-				continue
-			}
-
-			// add elevation values based on height
-			ev := ElevationValues{
-				Elevation: wind[elevationIndex],
-			}
-			for _, windValue := range wind[elevationIndex+1:] {
-				ev.Values = append(ev.Values, windValue)
-			}
+		station, ok := airportWinds[record.Station]
+		if !ok {
+			station = &AirportWinds{AirportCode: record.Station}
+			airportWinds[record.Station] = station
+		}
 
-			if *ev.Elevation <= lowThreshold {
-				lowWinds.Data = append(lowWinds.Data, ev)
+		low, high := record.wind(), record.wind()
+		for _, level := range record.Levels {
+			if level.Elevation <= lowThreshold {
+				low.Data = append(low.Data, level)
 			} else {
-				highWinds.Data = append(highWinds.Data, ev)
+				high.Data = append(high.Data, level)
 			}
 		}
+		if len(low.Data) > 0 {
+			station.Low = append(station.Low, low)
+		}
+		if len(high.Data) > 0 {
+			station.High = append(station.High, high)
+		}
+	}
 
-		const (
-			UnknownIndex     = 0
-			BasedOnIndex     = 1
-			ValidIndex       = 2
-			ForUseStartIndex = 3
-			ForUseEndIndex   = 4
-		)
+	var res []AirportWinds
+	for _, code := range slices.Sorted(maps.Keys(airportWinds)) {
+		station := airportWinds[code]
+		byForUse := func(a, b Wind) int { return a.ForUseStart.Compare(b.ForUseStart) }
+		slices.SortStableFunc(station.Low, byForUse)
+		slices.SortStableFunc(station.High, byForUse)
+		res = append(res, *station)
+	}
 
-		if len(wt.Times) != 5 {
-			slog.Info("Expected 5 times for winds", slog.Int("actual", len(wt.Times)))
-			continue
-		}
+	return res, errors.Join(errs...)
+}
 
-		// We're only operating one type of wind per-loop one, but set both
-		lowWinds.BasedOn, highWinds.BasedOn = wt.Times[BasedOnIndex], wt.Times[BasedOnIndex]
-		lowWinds.Valid, highWinds.Valid = wt.Times[ValidIndex], wt.Times[ValidIndex]
-		lowWinds.ForUseStart, highWinds.ForUseStart = wt.Times[ForUseStartIndex], wt.Times[ForUseStartIndex]
-		lowWinds.ForUseEnd, highWinds.ForUseEnd = wt.Times[ForUseEndIndex], wt.Times[ForUseEndIndex]
-
-		// ignore nil's
-		if highWinds.Data == nil {
-			airportWinds[currentAirport] = AirportWinds{
-				AirportCode: airportWinds[currentAirport].AirportCode,
-				High:        airportWinds[currentAirport].High,
-				Low:         append(airportWinds[currentAirport].Low, lowWinds),
-			}
-		} else {
-			airportWinds[currentAirport] = AirportWinds{
-				AirportCode: airportWinds[currentAirport].AirportCode,
-				High:        append(airportWinds[currentAirport].High, highWinds),
-				Low:         airportWinds[currentAirport].Low,
-			}
-		}
+// wind is the record's times without any levels
+func (r *UpperWindRecord) wind() Wind {
+	return Wind{
+		Issued:      r.Issued,
+		BasedOn:     r.BasedOn,
+		Valid:       r.Valid,
+		ForUseStart: r.ForUseStart,
+		ForUseEnd:   r.ForUseEnd,
 	}
+}
 
-	return slices.Collect(maps.Values(airportWinds)), nil
+func toInt(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	i := int(math.Round(*f))
+	return &i
 }
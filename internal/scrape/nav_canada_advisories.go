@@ -0,0 +1,288 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/util"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdvisorySites are requested to cover every FIR in Canada, NavCanada returns the advisories for the FIR each is in
+var AdvisorySites = slices.Sorted(maps.Values(GFARegions))
+
+// An Advisory is a decoded SIGMET or AIRMET, a warning of hazardous weather over an area
+type Advisory struct {
+	Kind Alpha  `json:"kind"` // Sigmet or Airmet
+	Id   string `json:"id"`   // the series and number e.g. D2
+	FIR  string `json:"fir"`  // e.g. CZEG
+	// Hazard is as written e.g. SEV TS, MOD ICE, empty if it couldn't be found
+	Hazard string `json:"hazard"`
+	// Convective is true for thunderstorms, cumulonimbus and towering cumulus
+	Convective bool `json:"convective"`
+	// Observed is true if the hazard was observed rather than forecast
+	Observed bool `json:"observed"`
+	// Base and Top are in feet, a nil Base is the surface and a nil Top wasn't given
+	Base          *int      `json:"base"`
+	Top           *int      `json:"top"`
+	StartValidity time.Time `json:"start_validity"`
+	EndValidity   time.Time `json:"end_validity"`
+	Movement      *Movement `json:"movement"`         // nil if not given
+	Change        string    `json:"change,omitempty"` // NC, INTSF or WKN
+	// Polygon is the area affected, lines and points are widened by the distance given. nil if the area couldn't be
+	// decoded
+	Polygon geo.Polygon `json:"polygon,omitempty"`
+	// Unlocated is true if the area couldn't be decoded, the hazard could be anywhere in the FIR
+	Unlocated bool   `json:"unlocated,omitempty"`
+	Text      string `json:"text"`
+}
+
+// Movement is where an Advisory's hazard is heading
+type Movement struct {
+	Stationary bool   `json:"stationary,omitempty"`
+	Direction  string `json:"direction,omitempty"` // towards e.g. NE
+	Speed      int    `json:"speed,omitempty"`     // knots
+}
+
+// ValidAt reports whether at is within the advisory's validity
+func (a *Advisory) ValidAt(at time.Time) bool {
+	return !at.Before(a.StartValidity) && at.Before(a.EndValidity)
+}
+
+var (
+	advisoryHeader = regexp.MustCompile(`\b(?:([A-Z]{4}) )?(SIGMET|AIRMET) ([A-Z]{1,2}\d+) VALID \d{6}/\d{6}`)
+	advisoryCancel = regexp.MustCompile(`\bCNL (SIGMET|AIRMET) ([A-Z]{1,2}\d+)\b`)
+	advisoryHazard = regexp.MustCompile(`\bFIR (.+?) (?:OBS|FCST)\b`)
+	// advisoryHazardWords finds the hazard in bulletins without a FIR name in front of it
+	advisoryHazardWords = regexp.MustCompile(`\b(?:(?:SEV|MOD|EMBD|OBSC|FRQ|SQL|ISOL|OCNL|HVY) )?(?:TSGR|TS|TCU|CB|TURB|ICE|ICG|MTW|DS|SS|VA|TC)\b`)
+	advisoryConvective  = regexp.MustCompile(`\b(?:TS\w*|TCU|CB)\b`)
+	advisoryObserved    = regexp.MustCompile(`\bOBS\b`)
+
+	advisoryBand  = regexp.MustCompile(`\b(SFC|FL\d{3}|\d{4,5}FT)/(FL\d{3}|\d{3}|\d{4,5}FT)\b`)
+	advisoryTop   = regexp.MustCompile(`\bTOP (?:ABV |BLW )?FL(\d{3})\b`)
+	advisoryBelow = regexp.MustCompile(`\bBLW FL(\d{3})\b`)
+	advisoryAbove = regexp.MustCompile(`\bABV FL(\d{3})\b`)
+
+	advisoryMovement   = regexp.MustCompile(`\bMOV ([NSEW]{1,3}) (\d+) ?KT\b`)
+	advisoryStationary = regexp.MustCompile(`\bSTNR\b`)
+	advisoryChange     = regexp.MustCompile(`\b(NC|INTSF|WKN)\b`)
+
+	// advisoryArea finds where the area is described, within a polygon or within a distance of a line or point
+	advisoryArea  = regexp.MustCompile(`\b(?:WI|WTN) (?:(\d+) ?NM (?:OF|WID)(?: LINE)? )?`)
+	advisoryPoint = regexp.MustCompile(`([NS])(\d{2})(\d{2})? ?([EW])(\d{3})(\d{2})?`)
+)
+
+// GetAdvisories returns the SIGMETs and AIRMETs in effect for the FIRs sites are in
+func GetAdvisories(ctx context.Context, sites ...string) ([]Advisory, error) {
+	var body NavCanadaResponse[any]
+
+	url := NewUrlBuilder().
+		Sites(sites...).
+		Alpha(Sigmet, Airmet).
+		Build()
+
+	err := util.GetAndParseJson(ctx, url, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProcessAdvisoriesResponse(body)
+}
+
+// ProcessAdvisoriesResponse decodes every SIGMET and AIRMET in ar, leaving out those that have been cancelled.
+// Advisories that can't be decoded are still returned with their text, unlocated, and the reason is returned as
+// SiteErrors by FIR alongside them. Only those without a validity are left out
+func ProcessAdvisoriesResponse(ar NavCanadaResponse[any]) ([]Advisory, error) {
+	var res []Advisory
+	var errs SiteErrors
+	cancelled := make(map[string]bool)
+
+	for _, datum := range ar.Data {
+		kind := Alpha(datum.Type)
+		if kind != Sigmet && kind != Airmet {
+			continue
+		}
+
+		text := normalizeAdvisory(datum.Text)
+		if match := advisoryCancel.FindStringSubmatch(text); match != nil {
+			fir := datum.Location
+			if header := advisoryHeader.FindStringSubmatch(text); header != nil && header[1] != "" {
+				fir = header[1]
+			}
+			cancelled[advisoryKey(fir, match[1], match[2])] = true
+			continue
+		}
+
+		// an advisory that can't be decoded is still kept, it's better to know there's a hazard somewhere in the FIR
+		advisory, err := ParseAdvisory(kind, text)
+		if err != nil {
+			errs = append(errs, &SiteError{Site: datum.Location, Source: NavCanadaSource, Kind: ErrParse, Message: fmt.Sprintf("%s: %s", kind, err), Err: err})
+		}
+		if advisory.FIR == "" {
+			advisory.FIR = datum.Location
+		}
+
+		advisory.StartValidity, err = parseNavCanadaTime(datum.StartValidity)
+		if err == nil {
+			advisory.EndValidity, err = parseNavCanadaTime(datum.EndValidity)
+		}
+		if err != nil {
+			errs = append(errs, &SiteError{Site: advisory.FIR, Source: NavCanadaSource, Kind: ErrParse, Message: fmt.Sprintf("%s %s: %s", kind, advisory.Id, err), Err: err})
+			continue
+		}
+
+		// the same advisory is returned once for every requested site in its FIR, those without an id by their text
+		if !slices.ContainsFunc(res, func(a Advisory) bool {
+			return a.FIR == advisory.FIR && a.Id == advisory.Id && a.Kind == kind && (a.Id != "" || a.Text == advisory.Text)
+		}) {
+			res = append(res, advisory)
+		}
+	}
+
+	res = slices.DeleteFunc(res, func(a Advisory) bool {
+		return cancelled[advisoryKey(a.FIR, strings.ToUpper(string(a.Kind)), a.Id)]
+	})
+	slices.SortStableFunc(res, func(a, b Advisory) int { return a.StartValidity.Compare(b.StartValidity) })
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
+
+func advisoryKey(fir, kind, id string) string {
+	return fir + "/" + kind + "/" + id
+}
+
+// normalizeAdvisory puts a bulletin on a single line with single spaces and without its terminating =
+func normalizeAdvisory(text string) string {
+	return strings.TrimSuffix(strings.Join(strings.Fields(text), " "), "=")
+}
+
+// ParseAdvisory decodes a SIGMET or AIRMET bulletin, the validity is left for the caller as NavCanada sends it with
+// the full date. If it can't be decoded the advisory is returned unlocated with its kind and text along with the error
+func ParseAdvisory(kind Alpha, text string) (Advisory, error) {
+	text = normalizeAdvisory(text)
+	res := Advisory{Kind: kind, Text: text, Unlocated: true}
+
+	header := advisoryHeader.FindStringSubmatch(text)
+	if header == nil {
+		return res, fmt.Errorf("no %s header in %q", kind, text)
+	}
+	res.FIR, res.Id = header[1], header[3]
+
+	if match := advisoryHazard.FindStringSubmatch(text); match != nil {
+		res.Hazard = match[1]
+	} else {
+		res.Hazard = advisoryHazardWords.FindString(text)
+	}
+	res.Convective = advisoryConvective.MatchString(res.Hazard)
+	res.Observed = advisoryObserved.MatchString(text)
+
+	res.Base, res.Top = parseAdvisoryAltitudes(text)
+
+	if advisoryStationary.MatchString(text) {
+		res.Movement = &Movement{Stationary: true}
+	} else if match := advisoryMovement.FindStringSubmatch(text); match != nil {
+		speed, _ := strconv.Atoi(match[2])
+		res.Movement = &Movement{Direction: match[1], Speed: speed}
+	}
+	if match := advisoryChange.FindStringSubmatch(text); match != nil {
+		res.Change = match[1]
+	}
+
+	res.Polygon = parseAdvisoryArea(text)
+	res.Unlocated = res.Polygon == nil
+	return res, nil
+}
+
+// parseAdvisoryAltitudes finds the base and top of the hazard e.g. FL240/FL300, SFC/080, TOP FL380 or BLW FL100
+func parseAdvisoryAltitudes(text string) (*int, *int) {
+	if match := advisoryBand.FindStringSubmatch(text); match != nil {
+		return parseAdvisoryAltitude(match[1]), parseAdvisoryAltitude(match[2])
+	}
+
+	var base, top *int
+	if match := advisoryTop.FindStringSubmatch(text); match != nil {
+		top = parseAdvisoryAltitude(match[1])
+	} else if match := advisoryBelow.FindStringSubmatch(text); match != nil {
+		top = parseAdvisoryAltitude(match[1])
+	}
+	if match := advisoryAbove.FindStringSubmatch(text); match != nil && !strings.Contains(text, "TOP ABV") {
+		base = parseAdvisoryAltitude(match[1])
+	}
+	return base, top
+}
+
+// parseAdvisoryAltitude converts SFC, FL350, 080 (hundreds of feet) or 5000FT into feet, nil for the surface
+func parseAdvisoryAltitude(token string) *int {
+	var feet int
+	switch {
+	case token == "SFC":
+		return nil
+	case strings.HasSuffix(token, "FT"):
+		feet, _ = strconv.Atoi(strings.TrimSuffix(token, "FT"))
+	default:
+		hundreds, _ := strconv.Atoi(strings.TrimPrefix(token, "FL"))
+		feet = hundreds * 100
+	}
+	return &feet
+}
+
+// parseAdvisoryArea decodes the area up to the end of the sentence describing it, e.g. WI N5630 W11305 - N5540
+// W11040 - N5440 W11130 or WTN 20 NM OF LINE N5000 W10500 - N5200 W10400
+func parseAdvisoryArea(text string) geo.Polygon {
+	loc := advisoryArea.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return nil
+	}
+
+	area := text[loc[1]:]
+	if end := strings.Index(area, ". "); end >= 0 {
+		area = area[:end]
+	}
+
+	var points []geo.Point
+	for _, match := range advisoryPoint.FindAllStringSubmatch(area, -1) {
+		points = append(points, geo.Point{
+			Lat: coordinate(match[1], match[2], match[3], "S"),
+			Lon: coordinate(match[4], match[5], match[6], "W"),
+		})
+	}
+
+	if loc[2] >= 0 {
+		width, _ := strconv.ParseFloat(text[loc[2]:loc[3]], 64)
+		return geo.Corridor(points, width)
+	}
+	if len(points) < 3 {
+		return nil
+	}
+	return geo.NewPolygon(points...)
+}
+
+// coordinate converts degrees and optional minutes into decimal degrees, negative in the negative hemisphere
+func coordinate(hemisphere, degrees, minutes, negative string) float64 {
+	d, _ := strconv.Atoi(degrees)
+	m, _ := strconv.Atoi(minutes)
+	res := float64(d) + float64(m)/60
+	if hemisphere == negative {
+		res = -res
+	}
+	return res
+}
+
+// parseNavCanadaTime parses the times NavCanada sends in either of its formats
+func parseNavCanadaTime(raw string) (time.Time, error) {
+	t, err := time.Parse(NavCanadaTimeFormat, raw)
+	if err != nil {
+		t, err = time.Parse(NavCanadaTimeFormatAlt, raw)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", raw)
+	}
+	return t.UTC(), nil
+}
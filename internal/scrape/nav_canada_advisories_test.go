@@ -0,0 +1,136 @@
+package scrape
+
+import (
+	"encoding/json"
+	"errors"
+	"scuffed-v2/internal/geo"
+	"testing"
+	"time"
+)
+
+const (
+	convectiveSigmet = "WSCN23 CWEG 181830\nCZEG SIGMET D2 VALID 181830/182230 CWEG-\nCZEG EDMONTON FIR SEV TS OBS AT 1820Z WI N5300 W10800 - N5300 W10500\n- N5130 W10500 - N5130 W10800 - N5300 W10800. TOP FL380. MOV NE 15KT. INTSF.\nRMK GFACN32="
+	icingAirmet      = "WACN23 CWEG 181800\nCZEG AIRMET B1 VALID 181800/182200 CWEG-\nCZEG EDMONTON FIR MOD ICE FCST WTN 20 NM OF LINE N5545 W10830 - N5615 W10925. FL060/FL120. STNR. NC.\nRMK GFACN32="
+)
+
+func TestParseAdvisory(t *testing.T) {
+	sigmet, err := ParseAdvisory(Sigmet, convectiveSigmet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sigmet.FIR != "CZEG" || sigmet.Id != "D2" || sigmet.Hazard != "SEV TS" || !sigmet.Convective || !sigmet.Observed {
+		t.Fatalf("expected an observed convective SIGMET D2 got %+v", sigmet)
+	}
+	if sigmet.Base != nil || sigmet.Top == nil || *sigmet.Top != 38000 {
+		t.Fatalf("expected tops at FL380 got %v %v", sigmet.Base, sigmet.Top)
+	}
+	if sigmet.Movement == nil || sigmet.Movement.Direction != "NE" || sigmet.Movement.Speed != 15 || sigmet.Change != "INTSF" {
+		t.Fatalf("expected moving NE at 15kt and intensifying got %+v %s", sigmet.Movement, sigmet.Change)
+	}
+	if len(sigmet.Polygon) != 5 || sigmet.Polygon[1] != (geo.Point{Lat: 53, Lon: -105}) || sigmet.Polygon[2].Lat != 51.5 {
+		t.Fatalf("expected the polygon as given got %v", sigmet.Polygon)
+	}
+	if !sigmet.Polygon.Contains(geo.Stations["CYXE"]) || sigmet.Polygon.Contains(geo.Stations["CYQR"]) {
+		t.Fatal("expected the polygon to cover Saskatoon but not Regina")
+	}
+
+	airmet, err := ParseAdvisory(Airmet, icingAirmet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if airmet.Hazard != "MOD ICE" || airmet.Convective || airmet.Observed {
+		t.Fatalf("expected forecast moderate icing got %+v", airmet)
+	}
+	if airmet.Base == nil || *airmet.Base != 6000 || airmet.Top == nil || *airmet.Top != 12000 {
+		t.Fatalf("expected 6000 to 12000ft got %v %v", airmet.Base, airmet.Top)
+	}
+	if airmet.Movement == nil || !airmet.Movement.Stationary {
+		t.Fatalf("expected stationary got %+v", airmet.Movement)
+	}
+	// the line runs from Buffalo Narrows towards La Loche
+	if !airmet.Polygon.Contains(geo.Stations["CYVT"]) || airmet.Polygon.Contains(geo.Stations["CYMM"]) {
+		t.Fatalf("expected the corridor to cover CYVT but not CYMM got %v", airmet.Polygon)
+	}
+
+	_, err = ParseAdvisory(Sigmet, "CZEG EDMONTON FIR SEV TURB")
+	if err == nil {
+		t.Fatal("expected an error without a header")
+	}
+}
+
+func TestParseAdvisoryAltitudes(t *testing.T) {
+	p := func(i int) *int { return &i }
+	cases := []struct {
+		text      string
+		base, top *int
+	}{
+		{"SFC/FL080.", nil, p(8000)},
+		{"FL020/080.", p(2000), p(8000)},
+		{"5000FT/FL120.", p(5000), p(12000)},
+		{"BLW FL100.", nil, p(10000)},
+		{"ABV FL300.", p(30000), nil},
+		{"TOP ABV FL400.", nil, p(40000)},
+		{"MOV E 10KT.", nil, nil},
+	}
+
+	for _, tc := range cases {
+		base, top := parseAdvisoryAltitudes(tc.text)
+		if !equalIntPtr(base, tc.base) || !equalIntPtr(top, tc.top) {
+			t.Fatalf("%s: expected %v/%v got %v/%v", tc.text, tc.base, tc.top, base, top)
+		}
+	}
+}
+
+func equalIntPtr(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func TestProcessAdvisoriesResponse(t *testing.T) {
+	type datum struct {
+		Type          string `json:"type"`
+		Location      string `json:"location"`
+		StartValidity string `json:"startValidity"`
+		EndValidity   string `json:"endValidity"`
+		Text          string `json:"text"`
+	}
+	data := []datum{
+		{"sigmet", "CZEG", "2025-06-18T18:30:00", "2025-06-18T22:30:00", convectiveSigmet},
+		// requested for a second site in the same FIR
+		{"sigmet", "CZEG", "2025-06-18T18:30:00", "2025-06-18T22:30:00", convectiveSigmet},
+		{"airmet", "CZEG", "2025-06-18T18:00:00", "2025-06-18T22:00:00", icingAirmet},
+		{"sigmet", "CZEG", "2025-06-18T17:00:00", "2025-06-18T21:00:00", "WSCN23 CWEG 181700\nCZEG SIGMET D1 VALID 181700/182100 CWEG-\nCZEG EDMONTON FIR SEV TURB FCST WI N5300 W11000 - N5400 W11000 - N5400 W10900. FL240/FL340. NC="},
+		{"sigmet", "CZEG", "2025-06-18T19:00:00", "2025-06-18T21:00:00", "WSCN23 CWEG 181900\nCZEG SIGMET D3 VALID 181900/182100 CWEG-\nCZEG EDMONTON FIR CNL SIGMET D1 181700/182100="},
+		{"sigmet", "CZEG", "2025-06-18T19:00:00", "2025-06-18T23:00:00", "garbled"},
+		{"metar", "CYXE", "", "", "METAR CYXE 181900Z 27010KT 15SM FEW050 20/10 A3001"},
+	}
+	raw, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response NavCanadaResponse[any]
+	err = json.Unmarshal(raw, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	advisories, err := ProcessAdvisoriesResponse(response)
+	var siteErrs SiteErrors
+	if !errors.As(err, &siteErrs) || len(siteErrs) != 1 || siteErrs[0].Site != "CZEG" || siteErrs[0].Kind != ErrParse {
+		t.Fatalf("expected the garbled SIGMET to be reported for CZEG got %v", err)
+	}
+	if len(advisories) != 3 || advisories[0].Id != "B1" || advisories[1].Id != "D2" {
+		t.Fatalf("expected AIRMET B1, SIGMET D2 then the garbled SIGMET got %+v", advisories)
+	}
+	if garbled := advisories[2]; !garbled.Unlocated || garbled.Kind != Sigmet || garbled.FIR != "CZEG" || garbled.Text != "garbled" {
+		t.Fatalf("expected the garbled SIGMET to be kept unlocated got %+v", garbled)
+	}
+	if advisories[0].Unlocated || advisories[1].Unlocated {
+		t.Fatalf("expected the decoded advisories to be located got %+v", advisories[:2])
+	}
+
+	sigmet := advisories[1]
+	expectedStart := time.Date(2025, 6, 18, 18, 30, 0, 0, time.UTC)
+	if !sigmet.StartValidity.Equal(expectedStart) || !sigmet.ValidAt(expectedStart.Add(4*time.Hour-time.Second)) || sigmet.ValidAt(expectedStart.Add(4*time.Hour)) {
+		t.Fatalf("expected valid from 1830Z to 2230Z got %s to %s", sigmet.StartValidity, sigmet.EndValidity)
+	}
+}
@@ -0,0 +1,293 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/util"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NotamTimeFormat is used by the B) and C) fields
+const NotamTimeFormat = "0601021504"
+
+// NotamCategory groups NOTAMs by what they affect
+type NotamCategory string
+
+const (
+	NotamRunway   NotamCategory = "runway" // runways, taxiways and aprons
+	NotamLighting NotamCategory = "lighting"
+	NotamNavAid   NotamCategory = "navaid"
+	NotamObstacle NotamCategory = "obstacle"
+	NotamAirspace NotamCategory = "airspace"
+	NotamOther    NotamCategory = "other"
+)
+
+var NotamCategories = []NotamCategory{NotamRunway, NotamLighting, NotamNavAid, NotamObstacle, NotamAirspace, NotamOther}
+
+// QLine is the coded summary of a NOTAM, e.g. CZEG/QMRLC/IV/NBO/A/000/999/5210N10642W005
+type QLine struct {
+	FIR     string `json:"fir"`
+	Code    string `json:"code"`    // e.g. QMRLC, runway closed
+	Traffic string `json:"traffic"` // I for IFR, V for VFR or both
+	Purpose string `json:"purpose"` // e.g. NBO
+	Scope   string `json:"scope"`   // A for aerodrome, E for en route, W for navigation warning
+	// Lower and Upper are in feet
+	Lower    int        `json:"lower"`
+	Upper    int        `json:"upper"`
+	Position *geo.Point `json:"position,omitempty"`
+	Radius   int        `json:"radius"` // nm
+}
+
+// A Notam is a decoded ICAO format NOTAM
+type Notam struct {
+	Id string `json:"id"` // e.g. A1234/25
+	// Type is N for new, R for replacing Replaces and C for cancelling Replaces
+	Type      string        `json:"type"`
+	Replaces  string        `json:"replaces,omitempty"`
+	QLine     *QLine        `json:"q_line,omitempty"`
+	Locations []string      `json:"locations"`
+	Category  NotamCategory `json:"category"`
+
+	StartValidity time.Time `json:"start_validity"`
+	// EndValidity is nil for permanent NOTAMs, Estimated is true if the end may change
+	EndValidity *time.Time `json:"end_validity"`
+	Estimated   bool       `json:"estimated,omitempty"`
+	Schedule    string     `json:"schedule,omitempty"` // when within the validity it applies e.g. DLY 1200-2000
+
+	Text  string `json:"text"`
+	Lower string `json:"lower,omitempty"` // as written e.g. SFC
+	Upper string `json:"upper,omitempty"` // as written e.g. 2500FT AGL
+	Raw   string `json:"raw"`
+}
+
+// ActiveAt reports whether at is within the NOTAM's validity
+func (n *Notam) ActiveAt(at time.Time) bool {
+	return !at.Before(n.StartValidity) && (n.EndValidity == nil || at.Before(*n.EndValidity))
+}
+
+var (
+	notamHeader   = regexp.MustCompile(`^\(?([A-Z]\d{4}/\d{2}) NOTAM([NRC])(?: ([A-Z]\d{4}/\d{2}))?`)
+	notamField    = regexp.MustCompile(`(?:^|\s)([QA-G])\)\s*`)
+	notamPosition = regexp.MustCompile(`^(\d{2})(\d{2})([NS])(\d{3})(\d{2})([EW])(\d{3})$`)
+
+	// notamTextCategories decides the category of NOTAMs without a Q-code subject, in order, from their text
+	notamTextCategories = []struct {
+		pattern  *regexp.Regexp
+		category NotamCategory
+	}{
+		{regexp.MustCompile(`\b(?:OBST|CRANE|TOWER)\b`), NotamObstacle},
+		{regexp.MustCompile(`\b(?:LGT|LGTS|LIGHTING|ARCAL|PAPI|APAPI)\b`), NotamLighting},
+		{regexp.MustCompile(`\b(?:NDB|VOR|DME|ILS|LOC|GP|GNSS|GPS|RNAV|RNP)\b`), NotamNavAid},
+		{regexp.MustCompile(`\b(?:RWY|TWY|APRON)\b`), NotamRunway},
+	}
+)
+
+// GetNotams returns the NOTAMs in effect or upcoming for sites
+func GetNotams(ctx context.Context, sites ...string) ([]Notam, error) {
+	var body NavCanadaResponse[any]
+
+	url := NewUrlBuilder().
+		Sites(sites...).
+		Alpha(Notams).
+		Build()
+
+	err := util.GetAndParseJson(ctx, url, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProcessNotamResponse(body)
+}
+
+// ProcessNotamResponse decodes every NOTAM in nr, leaving out those that have been replaced or cancelled. NOTAMs that
+// can't be decoded are skipped and returned as SiteErrors by location alongside the rest
+func ProcessNotamResponse(nr NavCanadaResponse[any]) ([]Notam, error) {
+	var res []Notam
+	var errs SiteErrors
+	superseded := make(map[string]bool)
+
+	for _, datum := range nr.Data {
+		if Alpha(datum.Type) != Notams {
+			continue
+		}
+
+		notam, err := ParseNotam(notamText(datum.Text))
+		if err != nil {
+			errs = append(errs, &SiteError{Site: datum.Location, Source: NavCanadaSource, Kind: ErrParse, Message: fmt.Sprintf("notam: %s", err), Err: err})
+			continue
+		}
+
+		if notam.Replaces != "" {
+			superseded[notam.Replaces] = true
+		}
+		// NOTAMs for more than one requested site are returned for each of them
+		if notam.Type != "C" && !slices.ContainsFunc(res, func(n Notam) bool { return n.Id == notam.Id }) {
+			res = append(res, notam)
+		}
+	}
+
+	res = slices.DeleteFunc(res, func(n Notam) bool { return superseded[n.Id] })
+	slices.SortStableFunc(res, func(a, b Notam) int { return a.StartValidity.Compare(b.StartValidity) })
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
+
+// notamText is the raw NOTAM in a datum's Text, which is sometimes escaped JSON holding it alongside translations
+func notamText(text string) string {
+	if !strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return text
+	}
+
+	var decoded struct {
+		Raw string `json:"raw"`
+	}
+	err := json.Unmarshal([]byte(text), &decoded)
+	if err != nil || decoded.Raw == "" {
+		return text
+	}
+	return decoded.Raw
+}
+
+// ParseNotam decodes an ICAO format NOTAM e.g.
+//
+//	(A1234/25 NOTAMN
+//	Q) CZEG/QMRLC/IV/NBO/A/000/999/5210N10642W005
+//	A) CYXE B) 2506181200 C) 2506201800 EST
+//	E) RWY 09/27 CLSD)
+func ParseNotam(raw string) (Notam, error) {
+	raw = strings.TrimSpace(raw)
+	res := Notam{Raw: raw, Category: NotamOther}
+
+	header := notamHeader.FindStringSubmatch(raw)
+	if header == nil {
+		return res, fmt.Errorf("no NOTAM header in %q", raw)
+	}
+	res.Id, res.Type, res.Replaces = header[1], header[2], header[3]
+
+	fields := notamFields(strings.TrimSuffix(raw, ")"))
+
+	if q, ok := fields["Q"]; ok {
+		qLine, err := parseQLine(q)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", res.Id, err)
+		}
+		res.QLine = &qLine
+	}
+
+	res.Locations = strings.Fields(fields["A"])
+	if len(res.Locations) == 0 {
+		return res, fmt.Errorf("%s: no location", res.Id)
+	}
+
+	var err error
+	res.StartValidity, err = time.Parse(NotamTimeFormat, fields["B"])
+	if err != nil {
+		return res, fmt.Errorf("%s: invalid start %q", res.Id, fields["B"])
+	}
+
+	end := fields["C"]
+	if trimmed, ok := strings.CutSuffix(end, "EST"); ok {
+		end, res.Estimated = strings.TrimSpace(trimmed), true
+	}
+	if end != "PERM" && end != "" {
+		endValidity, err := time.Parse(NotamTimeFormat, end)
+		if err != nil {
+			return res, fmt.Errorf("%s: invalid end %q", res.Id, fields["C"])
+		}
+		res.EndValidity = &endValidity
+	}
+
+	res.Schedule, res.Text, res.Lower, res.Upper = fields["D"], fields["E"], fields["F"], fields["G"]
+	res.Category = notamCategory(res.QLine, res.Text)
+	return res, nil
+}
+
+// notamFields splits a NOTAM into its lettered fields, which must be in order so a letter and bracket in the text
+// isn't taken as the start of another field
+func notamFields(raw string) map[string]string {
+	res := make(map[string]string)
+	matches := notamField.FindAllStringSubmatchIndex(raw, -1)
+
+	order := "QABCDEFG"
+	last := -1
+	var accepted [][]int
+	for _, match := range matches {
+		i := strings.Index(order, raw[match[2]:match[3]])
+		if i > last {
+			accepted = append(accepted, match)
+			last = i
+		}
+	}
+
+	for i, match := range accepted {
+		end := len(raw)
+		if i+1 < len(accepted) {
+			end = accepted[i+1][0]
+		}
+		res[raw[match[2]:match[3]]] = strings.TrimSpace(raw[match[1]:end])
+	}
+	return res
+}
+
+func parseQLine(raw string) (QLine, error) {
+	parts := strings.Split(strings.ReplaceAll(raw, " ", ""), "/")
+	if len(parts) != 8 {
+		return QLine{}, fmt.Errorf("expected 8 fields in Q line %q", raw)
+	}
+
+	res := QLine{FIR: parts[0], Code: parts[1], Traffic: parts[2], Purpose: parts[3], Scope: parts[4]}
+
+	lower, lowerErr := strconv.Atoi(parts[5])
+	upper, upperErr := strconv.Atoi(parts[6])
+	if lowerErr != nil || upperErr != nil {
+		return res, fmt.Errorf("invalid limits in Q line %q", raw)
+	}
+	res.Lower, res.Upper = lower*100, upper*100
+
+	if match := notamPosition.FindStringSubmatch(parts[7]); match != nil {
+		res.Position = &geo.Point{
+			Lat: coordinate(match[3], match[1], match[2], "S"),
+			Lon: coordinate(match[6], match[4], match[5], "W"),
+		}
+		res.Radius, _ = strconv.Atoi(match[7])
+	}
+
+	return res, nil
+}
+
+// notamCategory is decided by the subject of the Q-code e.g. the MR of QMRLC, NOTAMs without one are categorized by
+// their text
+func notamCategory(qLine *QLine, text string) NotamCategory {
+	if qLine != nil && len(qLine.Code) == 5 {
+		subject := qLine.Code[1:3]
+		switch {
+		case subject == "OB" || subject == "OL":
+			return NotamObstacle
+		case subject[0] == 'M':
+			return NotamRunway
+		case subject[0] == 'L':
+			return NotamLighting
+		case subject[0] == 'N' || subject[0] == 'I' || subject[0] == 'G':
+			return NotamNavAid
+		case subject[0] == 'A' || subject[0] == 'R' || subject[0] == 'W':
+			return NotamAirspace
+		case subject != "XX":
+			return NotamOther
+		}
+	}
+
+	for _, c := range notamTextCategories {
+		if c.pattern.MatchString(text) {
+			return c.category
+		}
+	}
+	return NotamOther
+}
@@ -0,0 +1,121 @@
+package scrape
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const runwayClosure = `(A1234/25 NOTAMN
+Q) CZEG/QMRLC/IV/NBO/A/000/999/5210N10642W005
+A) CYXE B) 2506181200 C) 2506201800 EST
+D) DLY 1200-2000
+E) RWY 09/27 CLSD)`
+
+func TestParseNotam(t *testing.T) {
+	notam, err := ParseNotam(runwayClosure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notam.Id != "A1234/25" || notam.Type != "N" || notam.Category != NotamRunway || notam.Text != "RWY 09/27 CLSD" {
+		t.Fatalf("expected a new runway NOTAM got %+v", notam)
+	}
+	if !reflect.DeepEqual(notam.Locations, []string{"CYXE"}) || notam.Schedule != "DLY 1200-2000" {
+		t.Fatalf("expected CYXE daily 1200-2000 got %v %q", notam.Locations, notam.Schedule)
+	}
+
+	q := notam.QLine
+	if q == nil || q.FIR != "CZEG" || q.Code != "QMRLC" || q.Scope != "A" || q.Upper != 99900 || q.Radius != 5 {
+		t.Fatalf("expected the Q line to be decoded got %+v", q)
+	}
+	if q.Position == nil || q.Position.Lat != 52+10.0/60 || q.Position.Lon != -(106+42.0/60) {
+		t.Fatalf("expected 5210N 10642W got %+v", q.Position)
+	}
+
+	start := time.Date(2025, 6, 18, 12, 0, 0, 0, time.UTC)
+	if !notam.StartValidity.Equal(start) || notam.EndValidity == nil || !notam.Estimated {
+		t.Fatalf("expected 1200Z until an estimated 2025-06-20 1800Z got %s %v", notam.StartValidity, notam.EndValidity)
+	}
+	if notam.ActiveAt(start.Add(-time.Minute)) || !notam.ActiveAt(start) || notam.ActiveAt(*notam.EndValidity) {
+		t.Fatal("expected the NOTAM to only be active within its validity")
+	}
+}
+
+func TestParseNotamCategories(t *testing.T) {
+	cases := []struct {
+		q, text  string
+		expected NotamCategory
+	}{
+		{"CZEG/QLRAS/IV/NBO/A/000/999/5210N10642W005", "RWY 09/27 EDGE LGT U/S", NotamLighting},
+		{"CZEG/QNBAS/IV/BO/AE/000/999/5210N10642W025", "NDB XE U/S", NotamNavAid},
+		{"CZEG/QOBCE/IV/M/A/000/999/5210N10642W005", "CRANE 250FT AGL", NotamObstacle},
+		{"CZEG/QRTCA/IV/BO/W/000/050/5210N10642W010", "FOREST FIRE AREA", NotamAirspace},
+		// without a subject the text is used
+		{"CZEG/QXXXX/IV/NBO/A/000/999/5530N10756W005", "RWY 14/32 CLSD", NotamRunway},
+		{"CZEG/QXXXX/IV/NBO/A/000/999/5530N10756W005", "ARCAL U/S", NotamLighting},
+		{"CZEG/QXXXX/IV/NBO/A/000/999/5530N10756W005", "FUEL NOT AVBL", NotamOther},
+	}
+
+	for _, tc := range cases {
+		raw := "(A0001/25 NOTAMN\nQ) " + tc.q + "\nA) CZPO B) 2506181200 C) PERM\nE) " + tc.text + ")"
+		notam, err := ParseNotam(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notam.Category != tc.expected {
+			t.Fatalf("%s %s: expected %s got %s", tc.q, tc.text, tc.expected, notam.Category)
+		}
+		if notam.EndValidity != nil {
+			t.Fatalf("expected a permanent NOTAM got %v", notam.EndValidity)
+		}
+	}
+}
+
+func TestProcessNotamResponse(t *testing.T) {
+	replaced := "(A1200/25 NOTAMN\nQ) CZEG/QMRLC/IV/NBO/A/000/999/5210N10642W005\nA) CYXE B) 2506101200 C) 2506151800\nE) RWY 09/27 CLSD)"
+	replacement := "(A1300/25 NOTAMR A1200/25\nQ) CZEG/QMRLC/IV/NBO/A/000/999/5210N10642W005\nA) CYXE B) 2506151800 C) 2506171800\nE) RWY 09/27 CLSD)"
+	cancelled := "(A1100/25 NOTAMN\nQ) CZEG/QLRAS/IV/NBO/A/000/999/5210N10642W005\nA) CYXE B) 2506101200 C) 2506301800\nE) RWY 09/27 EDGE LGT U/S)"
+	cancellation := "(A1400/25 NOTAMC A1100/25\nQ) CZEG/QLRAK/IV/NBO/A/000/999/5210N10642W005\nA) CYXE B) 2506161200\nE) RWY 09/27 EDGE LGT RESUMED NORMAL OPS)"
+	escaped, _ := json.Marshal(map[string]string{"raw": runwayClosure, "english": "RUNWAY 09/27 CLOSED"})
+
+	type datum struct {
+		Type     string `json:"type"`
+		Location string `json:"location"`
+		Text     string `json:"text"`
+	}
+	data := []datum{
+		{"notam", "CYXE", replaced},
+		{"notam", "CYXE", replacement},
+		{"notam", "CYXE", cancelled},
+		{"notam", "CYXE", cancellation},
+		{"notam", "CYXE", string(escaped)},
+		{"notam", "CYQR", string(escaped)},
+		{"notam", "CYXE", "garbled"},
+		{"metar", "CYXE", "METAR CYXE 181900Z 27010KT 15SM FEW050 20/10 A3001"},
+	}
+	raw, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response NavCanadaResponse[any]
+	err = json.Unmarshal(raw, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notams, err := ProcessNotamResponse(response)
+	var siteErrs SiteErrors
+	if !errors.As(err, &siteErrs) || len(siteErrs) != 1 || siteErrs[0].Site != "CYXE" || siteErrs[0].Kind != ErrParse {
+		t.Fatalf("expected the garbled NOTAM to be reported for CYXE got %v", err)
+	}
+	var ids []string
+	for _, notam := range notams {
+		ids = append(ids, notam.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"A1300/25", "A1234/25"}) {
+		t.Fatalf("expected only the replacement and the runway closure got %v", ids)
+	}
+}
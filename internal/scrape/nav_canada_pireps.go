@@ -0,0 +1,236 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/util"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Pirep is a decoded pilot report of the conditions encountered in flight
+type Pirep struct {
+	Urgent bool `json:"urgent"` // UUA rather than UA
+	// Location is the /OV field as written, Position is nil if it couldn't be decoded
+	Location string     `json:"location"`
+	Position *geo.Point `json:"position"`
+	Time     time.Time  `json:"time"`
+	// Altitude is in feet, nil if it is unknown or the report was during climb or descent
+	Altitude     *int            `json:"altitude"`
+	AircraftType string          `json:"aircraft_type,omitempty"`
+	Turbulence   *PirepCondition `json:"turbulence,omitempty"`
+	Icing        *PirepCondition `json:"icing,omitempty"`
+	Remarks      string          `json:"remarks,omitempty"`
+	// Sites are the requested sites the report was returned for
+	Sites []string `json:"sites,omitempty"`
+	Text  string   `json:"text"`
+}
+
+// PirepCondition is the turbulence or icing reported
+type PirepCondition struct {
+	Intensity string `json:"intensity"`      // e.g. NEG, LGT, MOD-SEV, empty if it couldn't be found
+	Type      string `json:"type,omitempty"` // e.g. CHOP or CAT for turbulence, RIME, CLR or MX for icing
+	Text      string `json:"text"`
+}
+
+// pirepTimeSlack is how far after the reference time a report's /TM can be before it's taken to be from the day before
+const pirepTimeSlack = time.Hour
+
+var (
+	pirepHeader   = regexp.MustCompile(`\b(UUA|UA) +/OV`)
+	pirepField    = regexp.MustCompile(`/(OV|TM|FL|TP|SK|TA|WV|TB|IC|RM) ?`)
+	pirepRadial   = regexp.MustCompile(`^([A-Z0-9]{3,4}) ?(\d{3})(\d{3})$`)
+	pirepLatLon   = regexp.MustCompile(`^(\d{2})(\d{2})?([NS]) ?(\d{2,3})(\d{2})?([EW])$`)
+	pirepTime     = regexp.MustCompile(`^(\d{2})(\d{2})Z?$`)
+	pirepAltitude = regexp.MustCompile(`^(\d{3})(?:-(\d{3}))?$`)
+
+	pirepIntensity      = regexp.MustCompile(`\b(NEG|NIL|SMTH|TRACE|TRC|LGT|MOD|SEV|EXTRM)(?:-(LGT|MOD|SEV|EXTRM))?\b`)
+	pirepTurbulenceType = regexp.MustCompile(`\b(CAT|CHOP|LLWS|MWAVE)\b`)
+	pirepIcingType      = regexp.MustCompile(`\b(RIME|CLR|MX)\b`)
+)
+
+// GetPireps returns the PIREPs within radius nautical miles of sites
+func GetPireps(ctx context.Context, radius int, sites ...string) ([]Pirep, error) {
+	var body NavCanadaResponse[Positions]
+
+	url := NewUrlBuilder().
+		Sites(sites...).
+		Alpha(Pireps).
+		Radius(radius).
+		Build()
+
+	err := util.GetAndParseJson(ctx, url, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ProcessPirepResponse(body, time.Now())
+}
+
+// ProcessPirepResponse decodes every PIREP in pr, resolving their times from when NavCanada says they're valid or ref.
+// PIREPs that can't be decoded are skipped and returned as SiteErrors for each site they're near alongside the rest
+func ProcessPirepResponse(pr NavCanadaResponse[Positions], ref time.Time) ([]Pirep, error) {
+	var res []Pirep
+	var errs SiteErrors
+
+	for _, datum := range pr.Data {
+		if Alpha(datum.Type) != Pireps {
+			continue
+		}
+
+		// the validity is when the report was made, a closer reference than now for resolving its /TM
+		datumRef := ref
+		if start, err := parseNavCanadaTime(datum.StartValidity); err == nil {
+			datumRef = start
+		}
+
+		pirep, err := ParsePirep(datum.Text, datumRef)
+		if err != nil {
+			sites := datum.Positions.Sites()
+			if len(sites) == 0 {
+				sites = []string{datum.Location}
+			}
+			for _, site := range sites {
+				errs = append(errs, &SiteError{Site: site, Source: NavCanadaSource, Kind: ErrParse, Message: fmt.Sprintf("pirep: %s", err), Err: err})
+			}
+			continue
+		}
+
+		// reports near more than one requested site are returned for each of them
+		i := slices.IndexFunc(res, func(p Pirep) bool { return p.Text == pirep.Text })
+		if i < 0 {
+			res = append(res, pirep)
+			i = len(res) - 1
+		}
+		for _, site := range datum.Positions.Sites() {
+			if !slices.Contains(res[i].Sites, site) {
+				res[i].Sites = append(res[i].Sites, site)
+			}
+		}
+	}
+
+	slices.SortStableFunc(res, func(a, b Pirep) int { return b.Time.Compare(a.Time) })
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
+
+// ParsePirep decodes a PIREP e.g. YXE UA /OV YXE 090010 /TM 1820 /FL080 /TP C172 /TB MOD CHOP /IC LGT RIME, resolving
+// its time to the latest one no more than pirepTimeSlack after ref
+func ParsePirep(text string, ref time.Time) (Pirep, error) {
+	text = strings.TrimSuffix(strings.Join(strings.Fields(text), " "), "=")
+	res := Pirep{Text: text}
+
+	loc := pirepHeader.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return res, fmt.Errorf("no UA or UUA in %q", text)
+	}
+	res.Urgent = text[loc[2]:loc[3]] == "UUA"
+
+	fields := pirepFields(text[loc[2]:])
+
+	res.Location = fields["OV"]
+	res.Position = pirepPosition(res.Location)
+
+	res.Time = ref
+	if match := pirepTime.FindStringSubmatch(fields["TM"]); match != nil {
+		hour, _ := strconv.Atoi(match[1])
+		minute, _ := strconv.Atoi(match[2])
+		res.Time = time.Date(ref.Year(), ref.Month(), ref.Day(), hour, minute, 0, 0, time.UTC)
+		if res.Time.After(ref.Add(pirepTimeSlack)) {
+			res.Time = res.Time.AddDate(0, 0, -1)
+		}
+	} else if fields["TM"] != "" {
+		return res, fmt.Errorf("invalid time %q", fields["TM"])
+	}
+
+	if match := pirepAltitude.FindStringSubmatch(fields["FL"]); match != nil {
+		hundreds, _ := strconv.Atoi(match[1])
+		altitude := hundreds * 100
+		res.Altitude = &altitude
+	}
+
+	res.AircraftType = fields["TP"]
+	res.Remarks = fields["RM"]
+	if tb, ok := fields["TB"]; ok {
+		res.Turbulence = pirepCondition(tb, pirepTurbulenceType)
+	}
+	if ic, ok := fields["IC"]; ok {
+		res.Icing = pirepCondition(ic, pirepIcingType)
+	}
+
+	return res, nil
+}
+
+// pirepFields splits a PIREP into its /XX fields
+func pirepFields(text string) map[string]string {
+	res := make(map[string]string)
+	matches := pirepField.FindAllStringSubmatchIndex(text, -1)
+	for i, match := range matches {
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		res[text[match[2]:match[3]]] = strings.TrimSpace(text[match[1]:end])
+	}
+	return res
+}
+
+// pirepPosition decodes a station (YXE or CYXE), a radial and distance from one (YXE 090010, the radial taken as true
+// rather than magnetic), a latitude and longitude (5210N10642W) or the midpoint between two stations (YXE-YQR)
+func pirepPosition(location string) *geo.Point {
+	if from, to, ok := strings.Cut(location, "-"); ok {
+		a, b := pirepPosition(strings.TrimSpace(from)), pirepPosition(strings.TrimSpace(to))
+		if a == nil || b == nil {
+			return nil
+		}
+		midpoint := geo.Destination(*a, geo.Bearing(*a, *b), geo.Distance(*a, *b)/2)
+		return &midpoint
+	}
+
+	if match := pirepLatLon.FindStringSubmatch(location); match != nil {
+		return &geo.Point{
+			Lat: coordinate(match[3], match[1], match[2], "S"),
+			Lon: coordinate(match[6], match[4], match[5], "W"),
+		}
+	}
+
+	if match := pirepRadial.FindStringSubmatch(location); match != nil {
+		station := lookupStation(match[1])
+		if station == nil {
+			return nil
+		}
+		radial, _ := strconv.Atoi(match[2])
+		distance, _ := strconv.Atoi(match[3])
+		p := geo.Destination(*station, float64(radial), float64(distance))
+		return &p
+	}
+
+	return lookupStation(location)
+}
+
+// lookupStation finds a station by its ICAO or Canadian three letter identifier
+func lookupStation(id string) *geo.Point {
+	if p, ok := geo.Lookup(id); ok {
+		return &p
+	}
+	if len(id) == 3 {
+		if p, ok := geo.Lookup("C" + id); ok {
+			return &p
+		}
+	}
+	return nil
+}
+
+func pirepCondition(text string, types *regexp.Regexp) *PirepCondition {
+	res := &PirepCondition{Text: text, Type: types.FindString(text)}
+	if match := pirepIntensity.FindStringSubmatch(text); match != nil {
+		res.Intensity = match[0]
+	}
+	return res
+}
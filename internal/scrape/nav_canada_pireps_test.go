@@ -0,0 +1,119 @@
+package scrape
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"scuffed-v2/internal/geo"
+	"testing"
+	"time"
+)
+
+func TestParsePirep(t *testing.T) {
+	ref := time.Date(2025, 6, 18, 19, 0, 0, 0, time.UTC)
+	pirep, err := ParsePirep("UACN10 CYXU 181830\nYXE UA /OV YXE 090010 /TM 1820 /FL080 /TP C172 /TB MOD CHOP /IC LGT RIME /RM SMOOTH ABV 090=", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pirep.Urgent || pirep.Location != "YXE 090010" || pirep.AircraftType != "C172" || pirep.Remarks != "SMOOTH ABV 090" {
+		t.Fatalf("expected a routine report from a C172 got %+v", pirep)
+	}
+	if !pirep.Time.Equal(time.Date(2025, 6, 18, 18, 20, 0, 0, time.UTC)) {
+		t.Fatalf("expected 1820Z got %s", pirep.Time)
+	}
+	if pirep.Altitude == nil || *pirep.Altitude != 8000 {
+		t.Fatalf("expected 8000ft got %v", pirep.Altitude)
+	}
+	if pirep.Turbulence == nil || pirep.Turbulence.Intensity != "MOD" || pirep.Turbulence.Type != "CHOP" {
+		t.Fatalf("expected moderate chop got %+v", pirep.Turbulence)
+	}
+	if pirep.Icing == nil || pirep.Icing.Intensity != "LGT" || pirep.Icing.Type != "RIME" {
+		t.Fatalf("expected light rime got %+v", pirep.Icing)
+	}
+
+	// 10nm east of Saskatoon
+	if pirep.Position == nil || math.Abs(geo.Distance(*pirep.Position, geo.Stations["CYXE"])-10) > 0.01 || pirep.Position.Lon <= geo.Stations["CYXE"].Lon {
+		t.Fatalf("expected 10nm east of CYXE got %+v", pirep.Position)
+	}
+
+	// just after midnight reports from before midnight are from the day before
+	pirep, err = ParsePirep("YQR UUA /OV YXE-YQR /TM 2350 /FLUNKN /TP DH8D /TB SEV-EXTRM", ref.Add(5*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pirep.Urgent || pirep.Altitude != nil || pirep.Turbulence.Intensity != "SEV-EXTRM" || pirep.Icing != nil {
+		t.Fatalf("expected an urgent report of severe to extreme turbulence got %+v", pirep)
+	}
+	if !pirep.Time.Equal(time.Date(2025, 6, 18, 23, 50, 0, 0, time.UTC)) {
+		t.Fatalf("expected 2350Z the day before got %s", pirep.Time)
+	}
+	halfway := geo.Distance(geo.Stations["CYXE"], geo.Stations["CYQR"]) / 2
+	if pirep.Position == nil || math.Abs(geo.Distance(*pirep.Position, geo.Stations["CYXE"])-halfway) > 0.01 {
+		t.Fatalf("expected halfway between CYXE and CYQR got %+v", pirep.Position)
+	}
+
+	_, err = ParsePirep("YXE /OV YXE", ref)
+	if err == nil {
+		t.Fatal("expected an error without UA")
+	}
+}
+
+func TestPirepPosition(t *testing.T) {
+	cases := []struct {
+		location string
+		expected *geo.Point
+	}{
+		{"CYVT", &geo.Point{Lat: 55.8419, Lon: -108.4175}},
+		{"5210N10642W", &geo.Point{Lat: 52 + 10.0/60, Lon: -(106 + 42.0/60)}},
+		{"52N106W", &geo.Point{Lat: 52, Lon: -106}},
+		{"YVT 360000", &geo.Point{Lat: 55.8419, Lon: -108.4175}},
+		{"XXX 090010", nil},
+		{"YXE-XXX", nil},
+	}
+
+	for _, tc := range cases {
+		actual := pirepPosition(tc.location)
+		if (actual == nil) != (tc.expected == nil) || (actual != nil && geo.Distance(*actual, *tc.expected) > 0.01) {
+			t.Fatalf("%s: expected %v got %v", tc.location, tc.expected, actual)
+		}
+	}
+}
+
+func TestProcessPirepResponse(t *testing.T) {
+	type datum struct {
+		Type          string `json:"type"`
+		Location      string `json:"location"`
+		StartValidity string `json:"startValidity"`
+		Text          string `json:"text"`
+		Positions     any    `json:"position"`
+	}
+	data := []datum{
+		{"pirep", "CYXE", "2025-06-18T18:20:00", "YXE UA /OV YXE 090010 /TM 1820 /FL080 /TP C172 /TB MOD", map[string]any{"pointReference": "CYXE", "radialDistance": 10}},
+		{"pirep", "CYPA", "2025-06-18T18:20:00", "YXE UA /OV YXE 090010 /TM 1820 /FL080 /TP C172 /TB MOD", map[string]any{"pointReference": "CYPA", "radialDistance": 60}},
+		{"pirep", "CYXE", "2025-06-18T17:05:00", "YXE UA /OV YXE /TM 1705 /FL050 /TP PC12 /IC LGT", map[string]any{"pointReference": "CYXE", "radialDistance": 0}},
+		{"pirep", "CYXE", "2025-06-18T17:00:00", "garbled", map[string]any{"pointReference": "CYXE", "radialDistance": 0}},
+	}
+	raw, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var response NavCanadaResponse[Positions]
+	err = json.Unmarshal(raw, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pireps, err := ProcessPirepResponse(response, time.Date(2025, 6, 18, 19, 0, 0, 0, time.UTC))
+	var siteErrs SiteErrors
+	if !errors.As(err, &siteErrs) || len(siteErrs) != 1 || siteErrs[0].Site != "CYXE" || siteErrs[0].Kind != ErrParse {
+		t.Fatalf("expected the garbled PIREP to be reported for CYXE got %v", err)
+	}
+	if len(pireps) != 2 || pireps[0].AircraftType != "C172" || pireps[1].AircraftType != "PC12" {
+		t.Fatalf("expected the newest report first got %+v", pireps)
+	}
+	if !reflect.DeepEqual(pireps[0].Sites, []string{"CYXE", "CYPA"}) {
+		t.Fatalf("expected the report to be near CYXE and CYPA got %v", pireps[0].Sites)
+	}
+}
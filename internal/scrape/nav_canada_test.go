@@ -1,8 +1,11 @@
 package scrape
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
+	"scuffed-v2/internal/metar"
 	"scuffed-v2/internal/util"
 	"strings"
 	"testing"
@@ -26,23 +29,134 @@ func TestProcessGFAResponse(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		var result NavCanadaResponse[Position]
+		var result NavCanadaResponse[Positions]
 		err := util.ReadFileToStruct(tc.testFilePath, &result)
 		if err != nil {
 			t.Fatalf("Could not access test data, %s", err)
 		}
 
-		actual, err := ProcessGFAResponse(result)
+		gfas, err := ProcessGFAResponse(result)
 		if err != nil {
 			t.Fatalf("Unexpected error processing GFA response %s", err)
 		}
+		if len(gfas) != 1 {
+			t.Fatalf("Expected a single region got %d", len(gfas))
+		}
 
+		actual := gfas[0]
+		if actual.Region != "GFACN32" || !reflect.DeepEqual(actual.Sites, []string{"CYXE"}) {
+			t.Fatalf("Expected GFACN32 covering CYXE got %s covering %v", actual.Region, actual.Sites)
+		}
 		if actual.testString() != tc.expected {
 			t.Fatalf("\nExpected: %v\nActual:   %v", tc.expected, actual.testString())
 		}
 	}
 }
 
+func TestProcessGFAResponseRegions(t *testing.T) {
+	var result NavCanadaResponse[Positions]
+	err := util.ReadFileToStruct("testdata/happy_path/gfa_response.json", &result)
+	if err != nil {
+		t.Fatalf("Could not access test data, %s", err)
+	}
+
+	// the same charts for another region requested alongside, and a chart we don't know about
+	clouds := result.Data[0]
+	clouds.Location = "GFA/CLDWX/GFACN31/"
+	clouds.Positions = Positions{{PointReference: "CYVR"}}
+	unknown := result.Data[1]
+	unknown.Location = "GFA/RADAR/GFACN32/"
+	result.Data = append(result.Data, clouds, unknown)
+
+	gfas, err := ProcessGFAResponse(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gfas) != 2 || gfas[0].Region != "GFACN32" || gfas[1].Region != "GFACN31" {
+		t.Fatalf("Expected GFACN32 and GFACN31 got %+v", gfas)
+	}
+	if len(gfas[1].CloudsWeather) != 3 || len(gfas[1].IcingTurbulenceFreezing) != 0 || gfas[1].Sites[0] != "CYVR" {
+		t.Fatalf("Expected GFACN31 clouds for CYVR got %+v", gfas[1])
+	}
+	if len(gfas[0].Other["GFA/RADAR/GFACN32/"]) != 3 {
+		t.Fatalf("Expected the unknown chart to be kept got %+v", gfas[0].Other)
+	}
+}
+
+func TestGFAAt(t *testing.T) {
+	var result NavCanadaResponse[Positions]
+	err := util.ReadFileToStruct("testdata/happy_path/gfa_response.json", &result)
+	if err != nil {
+		t.Fatalf("Could not access test data, %s", err)
+	}
+	gfas, err := ProcessGFAResponse(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gfa := gfas[0]
+
+	if gfa.Previous == nil || len(gfa.Previous.CloudsWeather) != 3 || gfa.Previous.CloudsWeather[0].Id != "56723742" {
+		t.Fatalf("Expected the 18Z issuance as the previous got %+v", gfa.Previous)
+	}
+	expectedIssued := time.Date(2025, 5, 17, 23, 38, 45, 859000000, time.UTC)
+	if !gfa.CloudsWeather[0].Issued.Equal(expectedIssued) {
+		t.Fatalf("Expected issued %s got %s", expectedIssued, gfa.CloudsWeather[0].Issued)
+	}
+
+	cases := []struct {
+		at                 time.Time
+		latest, previous   string
+		turbulence         string
+		previousTurbulence string
+	}{
+		{time.Date(2025, 5, 18, 3, 0, 0, 0, time.UTC), "56731137", "56723747", "56731145", "56723793"},
+		// the end of a frame is the start of the next
+		{time.Date(2025, 5, 18, 6, 0, 0, 0, time.UTC), "56731152", "56723785", "56731150", "56723790"},
+		// past the end of the previous issuance
+		{time.Date(2025, 5, 18, 15, 0, 0, 0, time.UTC), "56731163", "", "56731173", ""},
+		// before the latest issuance
+		{time.Date(2025, 5, 17, 20, 0, 0, 0, time.UTC), "", "56723742", "", "56723770"},
+	}
+
+	id := func(frame *GFAMetadata) string {
+		if frame == nil {
+			return ""
+		}
+		return frame.Id
+	}
+	for _, tc := range cases {
+		latest, previous := gfa.At(tc.at)
+		actual := []string{id(latest.CloudsWeather), id(previous.CloudsWeather), id(latest.IcingTurbulenceFreezing), id(previous.IcingTurbulenceFreezing)}
+		expected := []string{tc.latest, tc.previous, tc.turbulence, tc.previousTurbulence}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: expected %v got %v", tc.at, expected, actual)
+		}
+	}
+}
+
+func TestExtractGFAIssuancesEmpty(t *testing.T) {
+	_, err := ExtractGFAIssuances(`{"frame_lists": []}`)
+	if err == nil {
+		t.Fatal("Expected an error without any frames")
+	}
+}
+
+func TestPositionsUnmarshal(t *testing.T) {
+	for _, input := range []string{
+		`{"pointReference": "CYXE", "radialDistance": 0}`,
+		`[{"pointReference": "CYXE", "radialDistance": 0}, {"pointReference": "CYXE", "radialDistance": 0}]`,
+	} {
+		var positions Positions
+		err := json.Unmarshal([]byte(input), &positions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(positions.Sites(), []string{"CYXE"}) {
+			t.Fatalf("%s: expected CYXE got %v", input, positions.Sites())
+		}
+	}
+}
+
 func TestNavCanUrl_GetUrl(t *testing.T) {
 	actual := NewUrlBuilder().
 		Sites("CYXE", "CYSF").
@@ -73,7 +187,7 @@ func TestNavCanUrl_BuildWinds(t *testing.T) {
 func TestGetWeatherReports(t *testing.T) {
 	expectedSites := []string{"CYXE", "CYSF"}
 
-	sites, err := GetNavCanWeatherReports(expectedSites)
+	sites, err := GetNavCanWeatherReports(context.Background(), expectedSites)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,10 +198,15 @@ func TestGetWeatherReports(t *testing.T) {
 }
 
 func TestGetGFAImageIds(t *testing.T) {
-	gfa, err := GetGFAImageIds()
+	gfas, err := GetGFAImageIds(context.Background(), "CYXE")
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(gfas) != 1 {
+		t.Fatalf("Expected a single region got %d", len(gfas))
+	}
+
+	gfa := gfas[0]
 
 	if len(gfa.IcingTurbulenceFreezing) != 3 || len(gfa.CloudsWeather) != 3 {
 		t.Fatalf("Expected 3 images for both IcingTurbulenceFreezing(%d) and CloudsWeather(%d)", len(gfa.IcingTurbulenceFreezing), len(gfa.CloudsWeather))
@@ -105,62 +224,166 @@ func TestGetWinds(t *testing.T) {
 	}
 
 	for _, tc := range cases {
-		_, err := GetWinds(tc.sites...)
+		_, err := GetWinds(context.Background(), tc.sites...)
 		if err != nil {
 			t.Fatalf("Should be able to get winds without error: %q", err)
 		}
 	}
 }
 
-// TestParseWindsText tests the custom json decoder for winds text, which takes an array of mixed data types and partitions it
-func TestParseWindsText(t *testing.T) {
-	input := "[\"FBCN35\", \"KWNO\", " +
-		"\"2025-06-08T13:57:00+00:00\", \"2025-06-08T12:00:00+00:00\", \"2025-06-09T12:00:00+00:00\", \"2025-06-09T06:00:00+00:00\", \"2025-06-09T18:00:00+00:00\", " +
-		"null, null, null, null, " +
-		"[[45000,330,34,-59,0],[53000,330,20,-58,0],[39000,310,58,-57,0],[34000,320,54,-48,0],[30000,310,51,-39,0],[24000,310,51,-24,0]]]"
+const testUpperWindRecord = "[\"FBCN35\", \"KWNO\", " +
+	"\"2025-06-08T13:57:00+00:00\", \"2025-06-08T12:00:00+00:00\", \"2025-06-09T12:00:00+00:00\", \"2025-06-09T06:00:00+00:00\", \"2025-06-09T18:00:00+00:00\", " +
+	"null, null, null, null, " +
+	"[[45000,330,34,-59,0],[53000,330,20,-58,0],[39000,310,58,-57,0],[34000,320,54,-48,0],[30000,310,51,-39,0],[24000,310,51,-24,0]]]"
 
-	f2p := func(f float64) *float64 { return &f }
-	expected :=
-		WindsText{
-			Numbers: []int{},
-			Strings: []string{"FBCN35", "KWNO"},
-			Arrays: [][]*float64{
-				{f2p(45000), f2p(330), f2p(34), f2p(-59), f2p(0)},
-				{f2p(53000), f2p(330), f2p(20), f2p(-58), f2p(0)},
-				{f2p(39000), f2p(310), f2p(58), f2p(-57), f2p(0)},
-				{f2p(34000), f2p(320), f2p(54), f2p(-48), f2p(0)},
-				{f2p(30000), f2p(310), f2p(51), f2p(-39), f2p(0)},
-				{f2p(24000), f2p(310), f2p(51), f2p(-24), f2p(0)}},
-			Times: []time.Time{},
-		}
+// TestParseUpperWindRecord tests the custom json decoder for upper wind records, which are an array of mixed data types
+func TestParseUpperWindRecord(t *testing.T) {
+	i2p := func(i int) *int { return &i }
+	expected := UpperWindRecord{
+		Bulletin:    "FBCN35",
+		Office:      "KWNO",
+		Issued:      time.Date(2025, 6, 8, 13, 57, 0, 0, time.UTC),
+		BasedOn:     time.Date(2025, 6, 8, 12, 0, 0, 0, time.UTC),
+		Valid:       time.Date(2025, 6, 9, 12, 0, 0, 0, time.UTC),
+		ForUseStart: time.Date(2025, 6, 9, 6, 0, 0, 0, time.UTC),
+		ForUseEnd:   time.Date(2025, 6, 9, 18, 0, 0, 0, time.UTC),
+		Levels: []ElevationValues{
+			{Elevation: 24000, Direction: i2p(310), Speed: i2p(51), Temperature: i2p(-24)},
+			{Elevation: 30000, Direction: i2p(310), Speed: i2p(51), Temperature: i2p(-39)},
+			{Elevation: 34000, Direction: i2p(320), Speed: i2p(54), Temperature: i2p(-48)},
+			{Elevation: 39000, Direction: i2p(310), Speed: i2p(58), Temperature: i2p(-57)},
+			{Elevation: 45000, Direction: i2p(330), Speed: i2p(34), Temperature: i2p(-59)},
+			{Elevation: 53000, Direction: i2p(330), Speed: i2p(20), Temperature: i2p(-58)},
+		},
+	}
 
-	var wt WindsText
-	err := json.NewDecoder(strings.NewReader(input)).Decode(&wt)
+	var record UpperWindRecord
+	err := json.NewDecoder(strings.NewReader(testUpperWindRecord)).Decode(&record)
 	if err != nil {
 		t.Fatal("UnmarshallJSON unable to parse input", err)
 	}
 
-	// check arrays
-	if len(wt.Arrays) != len(expected.Arrays) {
-		t.Errorf("expected %d arrays, got %d", len(expected.Arrays), len(wt.Arrays))
-	} else {
-		for i := range len(wt.Arrays) {
-			if !reflect.DeepEqual(wt.Arrays[i], expected.Arrays[i]) {
-				t.Errorf("expected array %+v, got %+v", expected.Arrays[i], wt.Arrays[i])
-			}
+	if !reflect.DeepEqual(record, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, record)
+	}
+}
+
+func TestParseUpperWindLevelEncodings(t *testing.T) {
+	f2p := func(f float64) *float64 { return &f }
+	cases := []struct {
+		values    []*float64
+		direction int
+		speed     int
+		lv        bool
+	}{
+		{[]*float64{f2p(6000), f2p(270), f2p(25), f2p(-2), f2p(0)}, 270, 25, false},
+		{[]*float64{f2p(3000), f2p(990), f2p(0), nil, f2p(0)}, 0, 0, true},
+		// 100kt or more has 500 added to the direction and 100kt taken off the speed
+		{[]*float64{f2p(34000), f2p(770), f2p(15), f2p(-50), f2p(0)}, 270, 115, false},
+	}
+
+	for _, tc := range cases {
+		level, err := decodeLevel(tc.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *level.Direction != tc.direction || *level.Speed != tc.speed || level.LightAndVariable != tc.lv {
+			t.Fatalf("expected %03d@%d (light and variable %t) got %03d@%d (%t)",
+				tc.direction, tc.speed, tc.lv, *level.Direction, *level.Speed, level.LightAndVariable)
 		}
 	}
+}
 
-	// check strings
-	if len(wt.Strings) != len(expected.Strings) {
-		t.Errorf("expected %d strings, got %d", len(expected.Strings), len(wt.Strings))
-		t.Errorf("expected: %v\n", expected.Strings)
-		t.Errorf("got: %v\n", wt.Strings)
-	} else {
-		for i := range len(wt.Strings) {
-			if wt.Strings[i] != expected.Strings[i] {
-				t.Errorf("expected  string %q, got %q", expected.Strings[i], wt.Strings[i])
-			}
+func TestParseUpperWindRecordMalformed(t *testing.T) {
+	cases := []struct {
+		input string
+		field int
+	}{
+		{`["FBCN35", "KWNO"]`, 2},
+		{strings.Replace(testUpperWindRecord, `"KWNO"`, `12`, 1), officeField},
+		{strings.Replace(testUpperWindRecord, `"2025-06-09T12:00:00+00:00"`, `"tomorrow"`, 1), validField},
+		{strings.Replace(testUpperWindRecord, `[45000,330,34,-59,0]`, `[45000,330]`, 1), levelsField},
+		{strings.Replace(testUpperWindRecord, `[45000,330,34,-59,0]`, `[45000,420,34,-59,0]`, 1), levelsField},
+	}
+
+	for _, tc := range cases {
+		var record UpperWindRecord
+		err := json.Unmarshal([]byte(tc.input), &record)
+
+		var malformed *MalformedRecordError
+		if !errors.As(err, &malformed) || malformed.Field != tc.field {
+			t.Fatalf("%s: expected a malformed record error at field %d got %v", tc.input, tc.field, err)
 		}
 	}
 }
+
+func TestProcessWindsResponse(t *testing.T) {
+	low := strings.Replace(testUpperWindRecord, `[[45000,330,34,-59,0],[53000,330,20,-58,0],[39000,310,58,-57,0],[34000,320,54,-48,0],[30000,310,51,-39,0],[24000,310,51,-24,0]]`,
+		`[[3000,990,0,null,0],[6000,270,25,-2,0],[18000,280,45,-25,0]]`, 1)
+
+	input, err := json.Marshal(map[string]any{"data": []map[string]string{
+		{"type": "upperwind", "location": "CYXE", "text": testUpperWindRecord},
+		{"type": "upperwind", "location": "CYXE", "text": low},
+		{"type": "upperwind", "location": "CYQR", "text": `["FBCN35"]`},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response NavCanadaResponse[any]
+	err = json.Unmarshal(input, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	winds, err := ProcessWindsResponse(response)
+
+	var malformed *MalformedRecordError
+	if !errors.As(err, &malformed) {
+		t.Fatalf("expected the CYQR record to be malformed got %v", err)
+	}
+	if len(winds) != 1 || winds[0].AirportCode != "CYXE" {
+		t.Fatalf("expected winds for CYXE got %+v", winds)
+	}
+	if len(winds[0].Low) != 1 || len(winds[0].Low[0].Data) != 3 || !winds[0].Low[0].Data[0].LightAndVariable {
+		t.Fatalf("expected 3 low levels starting light and variable got %+v", winds[0].Low)
+	}
+	if len(winds[0].High) != 1 || len(winds[0].High[0].Data) != 6 {
+		t.Fatalf("expected 6 high levels got %+v", winds[0].High)
+	}
+}
+
+func TestProcessMETARResponse(t *testing.T) {
+	input := `{"data": [
+		{"type": "metar", "location": "CYXE", "text": "METAR CYXE 242300Z 31012KT 15SM FEW030 BKN080 21/05 A2992 RMK CU2AC3 SLP142="},
+		{"type": "taf", "location": "CYXE", "text": "TAF CYXE 241740Z 2418/2518 27010KT P6SM FEW040 FM242200 30008KT P6SM SKC RMK NXT FCST BY 242300Z="}
+	]}`
+
+	var body NavCanadaResponse[any]
+	err := json.NewDecoder(strings.NewReader(input)).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := ProcessMETARResponse(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := reports["CYXE"]
+	if report == nil {
+		t.Fatal("expected a report for CYXE")
+	}
+	if len(report.Observations) != 1 || report.Observations[0].Station != "CYXE" {
+		t.Fatalf("expected 1 decoded metar got %+v", report.Observations)
+	}
+	if len(report.Forecasts) != 1 || len(report.Forecasts[0].Groups) != 2 {
+		t.Fatalf("expected 1 decoded taf with 2 groups got %+v", report.Forecasts)
+	}
+	if report.FlightCategory != metar.VFR {
+		t.Fatalf("expected VFR got %s", report.FlightCategory)
+	}
+	if len(report.ForecastCategories) != 24 {
+		t.Fatalf("expected 24 hourly forecast categories got %d", len(report.ForecastCategories))
+	}
+}
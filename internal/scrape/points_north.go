@@ -1,18 +1,36 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"scuffed-v2/internal/util"
+	"time"
 )
 
 var pointsNorthRegex = regexp.MustCompile(`(?i)<TD COLSPAN="3">(.*?)</TD>`)
 
-func GetPointsNorthWeatherReport(site string) (*WeatherReport, error) {
+const PointsNorthSource = "pointsnorth"
+
+func init() {
+	Register(&SiteSource{
+		SourceName:  PointsNorthSource,
+		Sites:       PointsNorthSites,
+		Provides:    []Capability{CapMetar},
+		Pull:        GetPointsNorthWeatherReport,
+		MaxInFlight: 1,
+	})
+}
+
+var PointsNorthSites = []string{
+	"CYNL", // Points North Landing
+}
+
+func GetPointsNorthWeatherReport(ctx context.Context, site string) (*WeatherReport, error) {
 	var data string
 
-	err := util.GetAndParseString(fmt.Sprintf("https://www.pointsnorthgroup.ca/weather/%s_metar.html", site), &data)
+	err := util.GetAndParseString(ctx, fmt.Sprintf("https://www.pointsnorthgroup.ca/weather/%s_metar.html", site), &data)
 	if err != nil {
 		return nil, err
 	}
@@ -35,5 +53,6 @@ func ProcessPointsNorthMetarResponse(mr string, site string) (*WeatherReport, er
 		res.Metar = append(res.Metar, match[1])
 	}
 
+	res.decodeMetars(time.Now())
 	return &res, nil
 }
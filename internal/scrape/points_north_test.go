@@ -1,12 +1,13 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
 
 func TestGetPointsNorthWeatherReport(t *testing.T) {
-	report, err := GetPointsNorthWeatherReport("CYNL")
+	report, err := GetPointsNorthWeatherReport(context.Background(), "CYNL")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1,17 +1,151 @@
 package scrape
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"scuffed-v2/internal/metar"
 	"strings"
+	"sync"
+	"time"
 )
 
-// TODO: need a "parallelize all of these, send results (all the same) to channel generic func"
-
 type WeatherReport struct {
 	Airport string   `json:"airport"`
 	Metar   []string `json:"metar"`
 	Taf     []string `json:"taf"`
 	Cams    []string `json:"cams"`
+
+	Observations []metar.Observation `json:"metar_decoded"`
+	Forecasts    []metar.TAF         `json:"taf_decoded"`
+
+	// FlightCategory is from the latest observation, ForecastCategories are hourly from the latest TAF
+	FlightCategory     metar.FlightCategory   `json:"flight_category"`
+	ForecastCategories []metar.HourlyCategory `json:"forecast_categories,omitempty"`
+
+	// Notams are only filled in when asked for, they aren't pulled with the report
+	Notams []Notam `json:"notams,omitempty"`
+
+	// Source is where the report was pulled from (the most preferred one once merged),
+	// Sources records which source each field came from
+	Source  string            `json:"-"`
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// decodeMetars parses each raw Metar into Observations, reports that can't be decoded are logged and skipped
+func (w *WeatherReport) decodeMetars(ref time.Time) {
+	w.Observations = nil
+	for _, raw := range w.Metar {
+		obs, err := metar.Parse(raw, ref)
+		if err != nil {
+			slog.Info("Unable to decode metar", slog.String("airport", w.Airport), slog.String("err", err.Error()))
+			continue
+		}
+		w.Observations = append(w.Observations, obs)
+	}
+
+	w.FlightCategory = metar.Unknown
+	if latest := w.LatestObservation(); latest != nil {
+		w.FlightCategory = latest.FlightCategory()
+	}
+}
+
+// decodeTafs parses each raw Taf into Forecasts, forecasts that can't be decoded are logged and skipped
+func (w *WeatherReport) decodeTafs(ref time.Time) {
+	w.Forecasts = nil
+	for _, raw := range w.Taf {
+		taf, err := metar.ParseTAF(raw, ref)
+		if err != nil {
+			slog.Info("Unable to decode taf", slog.String("airport", w.Airport), slog.String("err", err.Error()))
+			continue
+		}
+		w.Forecasts = append(w.Forecasts, taf)
+	}
+
+	w.ForecastCategories = nil
+	if latest := w.LatestForecast(); latest != nil {
+		w.ForecastCategories = latest.HourlyCategories()
+	}
+}
+
+// LatestObservation returns the most recently issued decoded metar, or nil if there are none
+func (w *WeatherReport) LatestObservation() *metar.Observation {
+	var latest *metar.Observation
+	for i := range w.Observations {
+		if latest == nil || w.Observations[i].Time.After(latest.Time) {
+			latest = &w.Observations[i]
+		}
+	}
+	return latest
+}
+
+// LatestForecast returns the most recently issued decoded taf, or nil if there are none
+func (w *WeatherReport) LatestForecast() *metar.TAF {
+	var latest *metar.TAF
+	for i := range w.Forecasts {
+		if latest == nil || w.Forecasts[i].Issued.After(latest.Issued) {
+			latest = &w.Forecasts[i]
+		}
+	}
+	return latest
+}
+
+// Parallelize calls f for each input with at most limit calls running at once, sending every result to the returned
+// channel which is closed once all calls are done. Inputs still waiting when ctx is done are passed straight to f so
+// it can report ctx's error
+func Parallelize[In, Out any](ctx context.Context, inputs []In, limit int, f func(context.Context, In) Out) <-chan Out {
+	return parallelize(ctx, inputs, make(chan struct{}, max(limit, 1)), f)
+}
+
+// parallelize is Parallelize limited by sem, which can be shared between calls to limit all of them together
+func parallelize[In, Out any](ctx context.Context, inputs []In, sem chan struct{}, f func(context.Context, In) Out) <-chan Out {
+	out := make(chan Out, len(inputs))
+
+	var wg sync.WaitGroup
+	for _, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			out <- f(ctx, input)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// withContext waits for f until ctx is done, f is left to finish in the background if ctx is done first
+func withContext[T any](ctx context.Context, f func() (T, error)) (T, error) {
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
 }
 
 // NOTE(adam); we can do a switch with this to generate urls for EACH site!
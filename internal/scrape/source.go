@@ -0,0 +1,132 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+)
+
+type Capability string
+
+const (
+	CapMetar Capability = "metar"
+	CapTaf   Capability = "taf"
+	CapCams  Capability = "cams"
+	CapWinds Capability = "winds"
+	CapGFA   Capability = "gfa"
+	// CapAdvisories is SIGMETs and AIRMETs
+	CapAdvisories Capability = "advisories"
+	CapNotams     Capability = "notams"
+	CapPireps     Capability = "pireps"
+)
+
+// A Source is somewhere WeatherReports can be pulled from, normally a single station operator
+type Source interface {
+	Name() string
+	SupportedSites() []string
+	// Capabilities lists the products the source provides
+	Capabilities() []Capability
+	// Fetch pulls reports for sites, which are all in SupportedSites. Reports that could be pulled should be returned
+	// even when some sites fail, with SiteErrors for the ones that did
+	Fetch(ctx context.Context, sites []string) ([]*WeatherReport, error)
+}
+
+var (
+	registryMu sync.Mutex
+	registered []Source
+)
+
+// Register makes source available from Sources, sources register themselves from an init in the file they're
+// defined in. Registering two sources with the same name panics
+func Register(source Source) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if slices.ContainsFunc(registered, func(s Source) bool { return s.Name() == source.Name() }) {
+		panic(fmt.Sprintf("source %q registered twice", source.Name()))
+	}
+	registered = append(registered, source)
+}
+
+// Sources returns every registered source, which sources are preferred for a site is set in SitePriority
+func Sources() []Source {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return slices.Clone(registered)
+}
+
+// BatchSource is a Source that pulls every site it is asked for in a single request
+type BatchSource struct {
+	SourceName string
+	Sites      []string
+	Provides   []Capability
+	Batch      func(ctx context.Context, sites []string) ([]*WeatherReport, error)
+}
+
+func (b *BatchSource) Name() string               { return b.SourceName }
+func (b *BatchSource) SupportedSites() []string   { return b.Sites }
+func (b *BatchSource) Capabilities() []Capability { return b.Provides }
+
+func (b *BatchSource) Fetch(ctx context.Context, sites []string) ([]*WeatherReport, error) {
+	return b.Batch(ctx, sites)
+}
+
+// defaultMaxInFlight is how many requests are made to a single source at once when MaxInFlight isn't set
+const defaultMaxInFlight = 4
+
+// SiteSource is a Source that pulls one site per request
+type SiteSource struct {
+	SourceName string
+	Sites      []string
+	Provides   []Capability
+	Pull       func(ctx context.Context, site string) (*WeatherReport, error)
+	// MaxInFlight limits how many requests are sent at once across every Fetch, so small operators' servers aren't
+	// hammered
+	MaxInFlight int
+
+	semOnce sync.Once
+	sem     chan struct{}
+}
+
+func (s *SiteSource) Name() string               { return s.SourceName }
+func (s *SiteSource) SupportedSites() []string   { return s.Sites }
+func (s *SiteSource) Capabilities() []Capability { return s.Provides }
+
+func (s *SiteSource) Fetch(ctx context.Context, sites []string) ([]*WeatherReport, error) {
+	// shared by every Fetch so concurrent requests and polling can't go over MaxInFlight together
+	s.semOnce.Do(func() {
+		maxInFlight := s.MaxInFlight
+		if maxInFlight <= 0 {
+			maxInFlight = defaultMaxInFlight
+		}
+		s.sem = make(chan struct{}, maxInFlight)
+	})
+
+	results := parallelize(ctx, sites, s.sem, func(ctx context.Context, site string) pullResult {
+		report, err := withContext(ctx, func() (*WeatherReport, error) {
+			return s.Pull(ctx, site)
+		})
+		if err != nil {
+			slog.Error("Unable to pull site", slog.String("err", err.Error()), slog.String("site", site))
+			return pullResult{errs: SiteErrors{NewSiteError(site, s.SourceName, err)}}
+		}
+		if report == nil {
+			return pullResult{}
+		}
+		return pullResult{reports: []*WeatherReport{report}}
+	})
+
+	var res []*WeatherReport
+	var errs SiteErrors
+	for result := range results {
+		res = append(res, result.reports...)
+		errs = append(errs, result.errs...)
+	}
+
+	if len(errs) > 0 {
+		return res, errs
+	}
+	return res, nil
+}
@@ -0,0 +1,23 @@
+package scrape
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSourcesRegistered(t *testing.T) {
+	expected := []string{CamecoSource, HighwaysSource, MesotechSource, NavCanadaSource, PointsNorthSource}
+
+	var names []string
+	for _, source := range Sources() {
+		names = append(names, source.Name())
+		if len(source.SupportedSites()) == 0 || len(source.Capabilities()) == 0 {
+			t.Fatalf("expected %s to have sites and capabilities", source.Name())
+		}
+	}
+	slices.Sort(names)
+
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected %v got %v", expected, names)
+	}
+}
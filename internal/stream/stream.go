@@ -0,0 +1,106 @@
+// Package stream fans out newly issued products to clients subscribed to the sites they cover
+package stream
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	Metar        Kind = "metar"
+	Speci        Kind = "speci"
+	Taf          Kind = "taf"
+	TafAmendment Kind = "taf_amendment"
+	GFA          Kind = "gfa"
+)
+
+// An Event is a product that was issued since the last time its site was polled
+type Event struct {
+	Kind Kind   `json:"kind"`
+	Site string `json:"site,omitempty"` // the region for GFAs, empty for products covering every site
+	// Time is when the product was issued, or when it was first seen for products without an issue time
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// bufferSize is how many events a subscriber can fall behind by before it is dropped
+const bufferSize = 64
+
+type subscriber struct {
+	sites  []string // nil for every site
+	events chan Event
+}
+
+func (s *subscriber) wants(event Event) bool {
+	return event.Site == "" || s.sites == nil || slices.Contains(s.sites, event.Site)
+}
+
+// Broker delivers published events to every subscriber interested in them. Events are never blocked on a slow
+// subscriber, it is unsubscribed instead and can reconnect
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Subscribe returns a channel of events for sites (every site when empty), the channel is closed once cancel is
+// called or the subscriber falls too far behind
+func (b *Broker) Subscribe(sites []string) (<-chan Event, func()) {
+	sub := &subscriber{events: make(chan Event, bufferSize)}
+	if len(sites) > 0 {
+		sub.sites = slices.Clone(sites)
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(sub)
+	}
+}
+
+// Publish sends events to every interested subscriber
+func (b *Broker) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		for _, event := range events {
+			if !sub.wants(event) {
+				continue
+			}
+			select {
+			case sub.events <- event:
+				continue
+			default:
+				b.remove(sub)
+			}
+			break
+		}
+	}
+}
+
+// Subscribers is how many clients are currently subscribed
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// remove closes sub's channel, b.mu must be held
+func (b *Broker) remove(sub *subscriber) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
@@ -0,0 +1,56 @@
+package stream
+
+import (
+	"testing"
+)
+
+func TestBrokerFiltersBySite(t *testing.T) {
+	broker := NewBroker()
+	cyxe, cancelCyxe := broker.Subscribe([]string{"CYXE"})
+	defer cancelCyxe()
+	all, cancelAll := broker.Subscribe(nil)
+	defer cancelAll()
+
+	broker.Publish(
+		Event{Kind: Metar, Site: "CJY4"},
+		Event{Kind: Speci, Site: "CYXE"},
+		Event{Kind: GFA},
+	)
+
+	expected := []Kind{Speci, GFA}
+	for _, kind := range expected {
+		if event := <-cyxe; event.Kind != kind {
+			t.Fatalf("expected %s got %s", kind, event.Kind)
+		}
+	}
+	if len(cyxe) != 0 {
+		t.Fatalf("expected CJY4 to be filtered out, %d events left", len(cyxe))
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected every event got %d", len(all))
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := NewBroker()
+	slow, cancel := broker.Subscribe(nil)
+
+	for range bufferSize + 1 {
+		broker.Publish(Event{Kind: Metar, Site: "CYXE"})
+	}
+
+	if broker.Subscribers() != 0 {
+		t.Fatalf("expected the slow subscriber to be dropped")
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != bufferSize {
+		t.Fatalf("expected the buffered %d events before the channel closed got %d", bufferSize, received)
+	}
+
+	// cancelling after being dropped is a no-op
+	cancel()
+}
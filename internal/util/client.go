@@ -0,0 +1,141 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	UserAgent = "scuffed-metar/2.0 (+https://github.com/adam-bunce/scuffed-metar-v2)"
+
+	defaultTimeout     = 15 * time.Second
+	defaultRetries     = 2
+	defaultBackoff     = 500 * time.Millisecond
+	defaultMaxBodySize = 10 << 20 // 10MiB
+)
+
+// ErrBodyTooLarge is returned when a response is bigger than the client's MaxBodySize
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// StatusError is returned when a request gets a non-2xx response
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// Body is the start of the response, upstream error pages are usually enough to tell what went wrong
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// retryable reports whether the request might succeed if it was sent again
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Client sends requests to upstream sources, every request is bounded by Timeout and the request's context
+type Client struct {
+	HTTP *http.Client
+	// Retries is how many more times idempotent requests are attempted after a network error, 429 or 5xx
+	Retries int
+	// Backoff is the wait before the first retry, doubling for each retry after
+	Backoff     time.Duration
+	MaxBodySize int64
+	UserAgent   string
+}
+
+// DefaultClient is shared by every scraper so connections to the same upstream are reused
+var DefaultClient = &Client{
+	HTTP:        &http.Client{Timeout: defaultTimeout},
+	Retries:     defaultRetries,
+	Backoff:     defaultBackoff,
+	MaxBodySize: defaultMaxBodySize,
+	UserAgent:   UserAgent,
+}
+
+// Do sends req with ctx, returning the body of the first 2xx response
+func (c *Client) Do(ctx context.Context, req *http.Request) ([]byte, error) {
+	attempts := 1
+	if isIdempotent(req) {
+		attempts += c.Retries
+	}
+
+	var err error
+	for attempt := range attempts {
+		if attempt > 0 {
+			wait := c.Backoff<<(attempt-1) + rand.N(c.Backoff/2+1)
+			select {
+			case <-ctx.Done():
+				return nil, errors.Join(ctx.Err(), err)
+			case <-time.After(wait):
+			}
+		}
+
+		var body []byte
+		body, err = c.do(ctx, req)
+		if err == nil {
+			return body, nil
+		}
+
+		var statusErr *StatusError
+		switch {
+		case ctx.Err() != nil, errors.Is(err, ErrBodyTooLarge):
+			return nil, err
+		case errors.As(err, &statusErr) && !statusErr.retryable():
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+func (c *Client) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	attempt := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		attempt.Body = body
+	}
+	if attempt.Header.Get("User-Agent") == "" {
+		attempt.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	res, err := c.HTTP.Do(attempt)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, c.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > c.MaxBodySize {
+		return nil, fmt.Errorf("%s: %w", req.URL, ErrBodyTooLarge)
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		const maxErrBody = 512
+		return nil, &StatusError{URL: req.URL.String(), StatusCode: res.StatusCode, Body: string(body[:min(len(body), maxErrBody)])}
+	}
+
+	return body, nil
+}
+
+// isIdempotent follows net/http's rules for which requests are safe to retry
+func isIdempotent(req *http.Request) bool {
+	if slices.Contains([]string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}, req.Method) {
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	return hasKey && (req.Body == nil || req.GetBody != nil)
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClient() *Client {
+	return &Client{
+		HTTP:        &http.Client{Timeout: time.Second},
+		Retries:     2,
+		Backoff:     time.Millisecond,
+		MaxBodySize: 64,
+		UserAgent:   UserAgent,
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != UserAgent {
+			t.Errorf("expected user agent %q got %q", UserAgent, r.Header.Get("User-Agent"))
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("METAR CYXE"))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	body, err := testClient().Do(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "METAR CYXE" || calls.Load() != 3 {
+		t.Fatalf("expected body after 3 attempts got %q after %d", body, calls.Load())
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "<html>not found</html>", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := testClient().Do(context.Background(), req)
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected a 404 StatusError got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a 404 not to be retried, sent %d requests", calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryPost(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	if _, err := testClient().Do(context.Background(), req); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected POST not to be retried, sent %d requests", calls.Load())
+	}
+}
+
+func TestClientBodyTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 65))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := testClient().Do(context.Background(), req); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected ErrBodyTooLarge got %v", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := testClient().Do(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded got %v", err)
+	}
+}
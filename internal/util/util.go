@@ -1,32 +1,30 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
-	"io"
 	"net/http"
 	"os"
 )
 
-// GetAndParseJson executed the request r and parses the body as json, placing the result into dest
-func GetAndParseJson[T any](url string, dest *T) error {
-	res, err := http.Get(url)
+// GetAndParseJson executes a GET request to url and parses the body as json, placing the result into dest
+func GetAndParseJson[T any](ctx context.Context, url string, dest *T) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	return json.NewDecoder(res.Body).Decode(dest)
+	return RequestAndParse(ctx, req, dest)
 }
 
-// GetAndParseString executed the request r and parses the body as json, placing the result into dest
-func GetAndParseString(url string, dest *string) error {
-	res, err := http.Get(url)
+// GetAndParseString executes a GET request to url and places the body into dest
+func GetAndParseString(ctx context.Context, url string, dest *string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	body, err := DefaultClient.Do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -36,15 +34,24 @@ func GetAndParseString(url string, dest *string) error {
 	return nil
 }
 
-// RequestAndParse executed the request r and parses the body as json, placing the result into dest
-func RequestAndParse[T any](r *http.Request, dest *T) error {
-	res, err := http.DefaultClient.Do(r)
+// GetBytes executes a GET request to url and returns the body
+func GetBytes(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return DefaultClient.Do(ctx, req)
+}
+
+// RequestAndParse executes the request r and parses the body as json, placing the result into dest
+func RequestAndParse[T any](ctx context.Context, r *http.Request, dest *T) error {
+	body, err := DefaultClient.Do(ctx, r)
 	if err != nil {
 		return err
 	}
-	defer res.Body.Close()
 
-	return json.NewDecoder(res.Body).Decode(dest)
+	return json.Unmarshal(body, dest)
 }
 
 // ReadFileToStruct reads the json file from the given filePath and unmarshal's its data to dest
@@ -0,0 +1,247 @@
+// Package winds estimates winds aloft at any altitude and position from the levels and stations they're forecast for
+package winds
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// maxStations is how many of the nearest stations are blended into an estimate
+	maxStations = 3
+	// colocated is close enough to a station to use its forecast as is
+	colocated = 1.0 // nm
+	// lapseRate is the standard temperature lapse rate, used below the lowest level with a temperature
+	lapseRate = 1.98 / 1000 // celsius per foot
+)
+
+var ErrNoForecast = errors.New("no upper wind forecast covers the time and position")
+
+// Conditions are the wind and temperature at a point
+type Conditions struct {
+	Direction   int      `json:"direction"` // degrees true
+	Speed       int      `json:"speed"`     // knots
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// StationWeight is how much a station's forecast contributed to an Estimate
+type StationWeight struct {
+	Station  string     `json:"station"`
+	Distance float64    `json:"distance"` // nm
+	Weight   float64    `json:"weight"`
+	Winds    Conditions `json:"winds"`
+}
+
+type Estimate struct {
+	Position geo.Point `json:"position"`
+	Altitude int       `json:"altitude"` // feet ASL
+	Time     time.Time `json:"time"`
+	Conditions
+	Stations []StationWeight `json:"stations"`
+}
+
+// sample is a wind as a vector so it can be averaged across north and direction changes, u is east and v is north
+type sample struct {
+	u, v        float64
+	temperature *float64
+}
+
+func toSample(direction, speed int) sample {
+	// direction is where the wind is blowing from
+	rad := float64(direction) * math.Pi / 180
+	return sample{u: -float64(speed) * math.Sin(rad), v: -float64(speed) * math.Cos(rad)}
+}
+
+func (s sample) conditions() Conditions {
+	speed := math.Hypot(s.u, s.v)
+	direction := int(math.Round(math.Mod(math.Atan2(-s.u, -s.v)*180/math.Pi+360, 360)))
+	if direction == 0 && math.Round(speed) > 0 {
+		direction = 360
+	}
+
+	res := Conditions{Direction: direction, Speed: int(math.Round(speed))}
+	if s.temperature != nil {
+		temperature := math.Round(*s.temperature*10) / 10
+		res.Temperature = &temperature
+	}
+	return res
+}
+
+// GroundSpeed is the speed over the ground in knots flying course (degrees true) at trueAirspeed knots through wind,
+// an error is returned if the crosswind is too strong to hold the course
+func GroundSpeed(trueAirspeed, course float64, wind Conditions) (float64, error) {
+	// the angle between where the wind is from and the course
+	angle := (float64(wind.Direction) - course) * math.Pi / 180
+	crosswind := float64(wind.Speed) * math.Sin(angle)
+	if math.Abs(crosswind) >= trueAirspeed {
+		return 0, fmt.Errorf("a %.0fkt crosswind is too strong for %.0fkt", math.Abs(crosswind), trueAirspeed)
+	}
+
+	correction := math.Asin(crosswind / trueAirspeed)
+	groundSpeed := trueAirspeed*math.Cos(correction) - float64(wind.Speed)*math.Cos(angle)
+	if groundSpeed <= 0 {
+		return 0, fmt.Errorf("a %dkt headwind is too strong for %.0fkt", wind.Speed, trueAirspeed)
+	}
+	return groundSpeed, nil
+}
+
+// ForUse returns the forecast in forecasts whose for-use period contains at
+func ForUse(forecasts []scrape.Wind, at time.Time) (scrape.Wind, bool) {
+	for _, forecast := range forecasts {
+		if !at.Before(forecast.ForUseStart) && at.Before(forecast.ForUseEnd) {
+			return forecast, true
+		}
+	}
+	return scrape.Wind{}, false
+}
+
+// AtAltitude interpolates the winds at altitude between the levels either side of it. Below the lowest level its wind
+// is used as is, there is no forecast above the highest level
+func AtAltitude(levels []scrape.ElevationValues, altitude int) (Conditions, error) {
+	s, err := atAltitude(levels, altitude)
+	if err != nil {
+		return Conditions{}, err
+	}
+	return s.conditions(), nil
+}
+
+func atAltitude(levels []scrape.ElevationValues, altitude int) (sample, error) {
+	var winds, temps []scrape.ElevationValues
+	for _, level := range levels {
+		if level.Direction != nil && level.Speed != nil {
+			winds = append(winds, level)
+		}
+		if level.Temperature != nil {
+			temps = append(temps, level)
+		}
+	}
+	byElevation := func(a, b scrape.ElevationValues) int { return a.Elevation - b.Elevation }
+	slices.SortFunc(winds, byElevation)
+	slices.SortFunc(temps, byElevation)
+
+	if len(winds) == 0 || altitude > winds[len(winds)-1].Elevation {
+		return sample{}, fmt.Errorf("no winds forecast at %dft", altitude)
+	}
+
+	var res sample
+	below, above := bracket(winds, altitude)
+	lower := toSample(*below.Direction, *below.Speed)
+	upper := toSample(*above.Direction, *above.Speed)
+	frac := fraction(below, above, altitude)
+	res.u = lower.u + (upper.u-lower.u)*frac
+	res.v = lower.v + (upper.v-lower.v)*frac
+
+	switch {
+	case len(temps) == 0 || altitude > temps[len(temps)-1].Elevation:
+	case altitude < temps[0].Elevation:
+		temperature := float64(*temps[0].Temperature) + float64(temps[0].Elevation-altitude)*lapseRate
+		res.temperature = &temperature
+	default:
+		below, above := bracket(temps, altitude)
+		temperature := float64(*below.Temperature) + float64(*above.Temperature-*below.Temperature)*fraction(below, above, altitude)
+		res.temperature = &temperature
+	}
+
+	return res, nil
+}
+
+// bracket returns the levels either side of altitude in sorted levels, both are the lowest level when altitude is
+// below it
+func bracket(levels []scrape.ElevationValues, altitude int) (scrape.ElevationValues, scrape.ElevationValues) {
+	i := sort.Search(len(levels), func(i int) bool { return levels[i].Elevation >= altitude })
+	if i == 0 {
+		return levels[0], levels[0]
+	}
+	return levels[i-1], levels[i]
+}
+
+func fraction(below, above scrape.ElevationValues, altitude int) float64 {
+	if above.Elevation == below.Elevation {
+		return 0
+	}
+	return float64(altitude-below.Elevation) / float64(above.Elevation-below.Elevation)
+}
+
+// Interpolate estimates the winds at altitude over position at a time from the forecasts for the nearest stations,
+// weighting each by the inverse square of its distance. Stations without a known position are skipped
+func Interpolate(stations []scrape.AirportWinds, position geo.Point, altitude int, at time.Time) (Estimate, error) {
+	type candidate struct {
+		StationWeight
+		sample sample
+	}
+
+	var candidates []candidate
+	for _, station := range stations {
+		stationPosition, ok := geo.Lookup(station.AirportCode)
+		if !ok {
+			continue
+		}
+
+		var levels []scrape.ElevationValues
+		if low, ok := ForUse(station.Low, at); ok {
+			levels = append(levels, low.Data...)
+		}
+		if high, ok := ForUse(station.High, at); ok {
+			levels = append(levels, high.Data...)
+		}
+
+		s, err := atAltitude(levels, altitude)
+		if err != nil {
+			continue
+		}
+
+		candidates = append(candidates, candidate{
+			StationWeight: StationWeight{Station: station.AirportCode, Distance: geo.Distance(position, stationPosition), Winds: s.conditions()},
+			sample:        s,
+		})
+	}
+
+	if len(candidates) == 0 {
+		return Estimate{}, ErrNoForecast
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.Distance, b.Distance) })
+	candidates = candidates[:min(len(candidates), maxStations)]
+	if candidates[0].Distance < colocated {
+		candidates = candidates[:1]
+	}
+
+	var total, tempTotal float64
+	var blended sample
+	var temperature float64
+	for i := range candidates {
+		c := &candidates[i]
+		c.Weight = 1
+		if len(candidates) > 1 {
+			c.Weight = 1 / (c.Distance * c.Distance)
+		}
+		total += c.Weight
+		blended.u += c.sample.u * c.Weight
+		blended.v += c.sample.v * c.Weight
+		if c.sample.temperature != nil {
+			temperature += *c.sample.temperature * c.Weight
+			tempTotal += c.Weight
+		}
+	}
+	blended.u /= total
+	blended.v /= total
+	if tempTotal > 0 {
+		temperature /= tempTotal
+		blended.temperature = &temperature
+	}
+
+	res := Estimate{Position: position, Altitude: altitude, Time: at, Conditions: blended.conditions()}
+	for _, c := range candidates {
+		c.Weight = math.Round(c.Weight/total*1000) / 1000
+		c.Distance = math.Round(c.Distance*10) / 10
+		res.Stations = append(res.Stations, c.StationWeight)
+	}
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package winds
+
+import (
+	"errors"
+	"math"
+	"scuffed-v2/internal/geo"
+	"scuffed-v2/internal/scrape"
+	"testing"
+	"time"
+)
+
+var (
+	issued = time.Date(2025, 6, 25, 0, 0, 0, 0, time.UTC)
+	at     = issued.Add(8 * time.Hour)
+)
+
+func p(i int) *int { return &i }
+
+func forecast(levels ...scrape.ElevationValues) scrape.Wind {
+	return scrape.Wind{
+		Data:        levels,
+		BasedOn:     issued,
+		Valid:       issued.Add(6 * time.Hour),
+		ForUseStart: issued.Add(2 * time.Hour),
+		ForUseEnd:   issued.Add(9 * time.Hour),
+	}
+}
+
+func TestAtAltitude(t *testing.T) {
+	levels := []scrape.ElevationValues{
+		{Elevation: 9000, Direction: p(270), Speed: p(30), Temperature: p(-5)},
+		{Elevation: 3000, Direction: p(350), Speed: p(10)},
+		{Elevation: 6000, Direction: p(10), Speed: p(20), Temperature: p(5)},
+	}
+
+	cases := []struct {
+		altitude    int
+		direction   int
+		speed       int
+		temperature *float64
+	}{
+		{6000, 10, 20, ptr(5.0)},
+		{7500, 307, 17, ptr(0.0)},
+		// between 350 and 10 interpolates through north rather than south
+		{4500, 3, 15, ptr(8.0)},
+		{1000, 350, 10, ptr(14.9)},
+	}
+
+	for _, tc := range cases {
+		actual, err := AtAltitude(levels, tc.altitude)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual.Direction != tc.direction || actual.Speed != tc.speed {
+			t.Fatalf("%dft: expected %03d@%d got %03d@%d", tc.altitude, tc.direction, tc.speed, actual.Direction, actual.Speed)
+		}
+		if actual.Temperature == nil || *actual.Temperature != *tc.temperature {
+			t.Fatalf("%dft: expected %.1fC got %v", tc.altitude, *tc.temperature, actual.Temperature)
+		}
+	}
+
+	if _, err := AtAltitude(levels, 12000); err == nil {
+		t.Fatalf("expected no winds above the highest level")
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
+
+func TestInterpolate(t *testing.T) {
+	stations := []scrape.AirportWinds{
+		{AirportCode: "CYXE", Low: []scrape.Wind{forecast(scrape.ElevationValues{Elevation: 6000, Direction: p(270), Speed: p(20), Temperature: p(4)})}},
+		{AirportCode: "CYMM", Low: []scrape.Wind{forecast(scrape.ElevationValues{Elevation: 6000, Direction: p(270), Speed: p(40), Temperature: p(0)})}},
+		// not valid at the requested time
+		{AirportCode: "CYPA", Low: []scrape.Wind{{Data: []scrape.ElevationValues{{Elevation: 6000, Direction: p(90), Speed: p(90)}}}}},
+		// unknown position
+		{AirportCode: "KXXX", Low: []scrape.Wind{forecast(scrape.ElevationValues{Elevation: 6000, Direction: p(90), Speed: p(90)})}},
+	}
+
+	// Buffalo Narrows is much closer to Fort McMurray than Saskatoon
+	estimate, err := Interpolate(stations, geo.Stations["CYVT"], 6000, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(estimate.Stations) != 2 {
+		t.Fatalf("expected CYXE and CYMM to be used got %+v", estimate.Stations)
+	}
+	if estimate.Stations[0].Station != "CYMM" || estimate.Stations[0].Weight <= 0.5 {
+		t.Fatalf("expected CYMM to be weighted the most got %+v", estimate.Stations)
+	}
+	if estimate.Direction != 270 || estimate.Speed <= 30 || estimate.Speed >= 40 {
+		t.Fatalf("expected 270 between 30 and 40kt got %03d@%d", estimate.Direction, estimate.Speed)
+	}
+
+	// at a station its forecast is used as is
+	estimate, err = Interpolate(stations, geo.Stations["CYXE"], 6000, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Speed != 20 || *estimate.Temperature != 4 {
+		t.Fatalf("expected CYXE's forecast got %+v", estimate.Conditions)
+	}
+
+	_, err = Interpolate(stations, geo.Stations["CYVT"], 6000, issued)
+	if !errors.Is(err, ErrNoForecast) {
+		t.Fatalf("expected ErrNoForecast before any forecast is for use got %v", err)
+	}
+}
+
+func TestGroundSpeed(t *testing.T) {
+	cases := []struct {
+		course   float64
+		wind     Conditions
+		expected float64
+	}{
+		{360, Conditions{Direction: 360, Speed: 20}, 100},
+		{90, Conditions{Direction: 270, Speed: 20}, 140},
+		// a direct crosswind costs a little to correct for
+		{360, Conditions{Direction: 90, Speed: 20}, 118.32},
+		{180, Conditions{}, 120},
+	}
+
+	for _, tc := range cases {
+		actual, err := GroundSpeed(120, tc.course, tc.wind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(actual-tc.expected) > 0.01 {
+			t.Fatalf("%03.0f with %03d@%d: expected %.2fkt got %.2fkt", tc.course, tc.wind.Direction, tc.wind.Speed, tc.expected, actual)
+		}
+	}
+
+	if _, err := GroundSpeed(60, 360, Conditions{Direction: 90, Speed: 70}); err == nil {
+		t.Fatal("expected a crosswind stronger than the airspeed to be an error")
+	}
+}